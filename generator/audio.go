@@ -0,0 +1,95 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AudioTrack describes an audio stream of a video, as probed
+type AudioTrack struct {
+	Language string `json:"language,omitempty"` // Language tag (e.g. pt-BR), empty if unknown
+	Title    string `json:"title,omitempty"`    // Title from the container (e.g. "Commentary")
+	Default  bool   `json:"default,omitempty"`  // Marked as the default track in the container
+}
+
+// SetAudioLanguage sets the language (e.g. en or pt-BR) of the audio track
+// the player selects, for videos with several tracks. Without it, the
+// video's default track plays.
+func (g *Generator) SetAudioLanguage(lang string) {
+	g.audioLang = lang
+}
+
+// audioTrack describes an audio stream for the metadata
+func audioTrack(stream *probeStream) AudioTrack {
+	track := AudioTrack{
+		Title:   strings.TrimSpace(stream.Tags["title"]),
+		Default: stream.Disposition["default"] == 1,
+	}
+	track.Language, _ = parseLanguage(stream.Tags["language"])
+	return track
+}
+
+// label returns the name of the n-th track (from 1) shown in the details
+// (e.g. "English", "English (Commentary)", "Track 2")
+func (t AudioTrack) label(n int) string {
+	name := languageName(t.Language)
+	switch {
+	case t.Language == "" && t.Title == "":
+		return fmt.Sprintf("Track %d", n)
+	case t.Language == "":
+		return t.Title
+	case t.Title == "" || strings.EqualFold(t.Title, name):
+		return name
+	default:
+		return name + " (" + t.Title + ")"
+	}
+}
+
+// AudioTracksText lists the audio tracks of videos that have more than one
+// (e.g. "English, Portuguese (Brazil)")
+func (v *Video) AudioTracksText() string {
+	if len(v.AudioTracks) < 2 {
+		return ""
+	}
+	labels := make([]string, len(v.AudioTracks))
+	for i, track := range v.AudioTracks {
+		labels[i] = track.label(i + 1)
+	}
+	return strings.Join(labels, ", ")
+}
+
+// audioLanguages returns the language of each audio track ("und" when
+// unknown) for the player, which matches them against the preferred
+// language. It is empty for videos with a single track.
+func (v *Video) audioLanguages() string {
+	if len(v.AudioTracks) < 2 {
+		return ""
+	}
+	languages := make([]string, len(v.AudioTracks))
+	for i, track := range v.AudioTracks {
+		languages[i] = track.Language
+		if languages[i] == "" {
+			languages[i] = "und"
+		}
+	}
+	return strings.Join(languages, " ")
+}
+
+// defaultAudioStream returns the position among streams of the track to
+// mark as default: the first one in the preferred language, otherwise the
+// source's default (or first) track
+func defaultAudioStream(streams []*probeStream, preferred string) int {
+	if preferred != "" {
+		for i, stream := range streams {
+			if tag, ok := parseLanguage(stream.Tags["language"]); ok && languageMatches(tag, preferred) {
+				return i
+			}
+		}
+	}
+	for i, stream := range streams {
+		if stream.Disposition["default"] == 1 {
+			return i
+		}
+	}
+	return 0
+}
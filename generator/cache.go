@@ -0,0 +1,142 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Metadata cache file (relative to output)
+const cacheFile = ".vsite/cache.json"
+
+// Bump when the cache layout changes so old caches are discarded
+const cacheVersion = 5
+
+// cacheEntry holds the metadata of a single file. It is valid as long as
+// the file size and modification time match.
+type cacheEntry struct {
+	Size     int64    `json:"size"`
+	ModTime  int64    `json:"mtime"` // Unix time in nanoseconds
+	Metadata Metadata `json:"metadata"`
+}
+
+// metadataCache persists probed metadata between runs, keyed by relative path
+type metadataCache struct {
+	Version int                    `json:"version"`
+	Entries map[string]*cacheEntry `json:"entries"`
+
+	path  string          // Cache file location
+	seen  map[string]bool // Keys looked up during this run
+	dirty bool            // Whether entries changed since loading
+}
+
+// loadCache reads the cache from path. A missing, unreadable or outdated
+// cache results in an empty one, so every file is processed again.
+func loadCache(path string) *metadataCache {
+	c := &metadataCache{
+		Version: cacheVersion,
+		Entries: make(map[string]*cacheEntry),
+		path:    path,
+		seen:    make(map[string]bool),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("Warning: Error reading metadata cache: %v\n", err)
+		}
+		return c
+	}
+
+	var stored metadataCache
+	if err := json.Unmarshal(data, &stored); err != nil {
+		fmt.Printf("Warning: Ignoring corrupt metadata cache: %v\n", err)
+		c.dirty = true
+		return c
+	}
+	if stored.Version != cacheVersion || stored.Entries == nil {
+		c.dirty = true
+		return c
+	}
+
+	c.Entries = stored.Entries
+	return c
+}
+
+// cacheKey normalizes a relative path so caches are portable across platforms
+func cacheKey(relPath string) string {
+	return filepath.ToSlash(relPath)
+}
+
+// lookup returns the entry for relPath if it is still valid for the file.
+// Every looked up path is kept when the cache is pruned.
+func (c *metadataCache) lookup(relPath string, info os.FileInfo) (*cacheEntry, bool) {
+	key := cacheKey(relPath)
+	c.seen[key] = true
+
+	entry, ok := c.Entries[key]
+	if !ok || entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() {
+		return nil, false
+	}
+	return entry, true
+}
+
+// store records the metadata of relPath for the current file state
+func (c *metadataCache) store(relPath string, info os.FileInfo, metadata Metadata) {
+	key := cacheKey(relPath)
+	c.seen[key] = true
+	c.Entries[key] = &cacheEntry{
+		Size:     info.Size(),
+		ModTime:  info.ModTime().UnixNano(),
+		Metadata: metadata,
+	}
+	c.dirty = true
+}
+
+// update replaces the metadata of relPath, keeping the file state it was stored for
+func (c *metadataCache) update(relPath string, metadata Metadata) {
+	if entry, ok := c.Entries[cacheKey(relPath)]; ok {
+		entry.Metadata = metadata
+		c.dirty = true
+	}
+}
+
+// prune drops entries for files that were not seen during this run
+func (c *metadataCache) prune() {
+	for key := range c.Entries {
+		if !c.seen[key] {
+			delete(c.Entries, key)
+			c.dirty = true
+		}
+	}
+}
+
+// save writes the cache to disk if anything changed
+func (c *metadataCache) save() error {
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so an interrupted run can't corrupt the cache
+	tmpPath := c.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	c.dirty = false
+	return nil
+}
@@ -0,0 +1,126 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Directory (relative to output) where chapter tracks are stored as WebVTT
+const chapterDir = ".vsite/chapters"
+
+// Generated files in chapterDir: chapter tracks and thumbnails
+var chapterPatterns = []string{"*.vtt", "*.jpg"}
+
+// Chapter is a named section of a video
+type Chapter struct {
+	Start float64 `json:"start"` // Start time in seconds
+	End   float64 `json:"end"`   // End time in seconds
+	Title string  `json:"title"` // Title from the container, "Chapter N" if unnamed
+
+	Thumbnail string `json:"-"` // Frame at the start (relative to output), detected chapters only
+}
+
+// probeChapter is a chapter as reported by ffprobe -show_chapters
+type probeChapter struct {
+	StartTime string            `json:"start_time"` // Seconds (e.g. 62.500000)
+	EndTime   string            `json:"end_time"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// applyChapters fills the chapters from ffprobe output. A single chapter
+// spanning the whole video is not worth navigating and is dropped.
+func (m *Metadata) applyChapters(chapters []probeChapter) {
+	m.Chapters = nil
+	if len(chapters) < 2 {
+		return
+	}
+	for _, chapter := range chapters {
+		start, err1 := strconv.ParseFloat(chapter.StartTime, 64)
+		end, err2 := strconv.ParseFloat(chapter.EndTime, 64)
+		if err1 != nil || err2 != nil || end <= start {
+			continue
+		}
+		title := strings.TrimSpace(chapter.Tags["title"])
+		if title == "" {
+			title = fmt.Sprintf("Chapter %d", len(m.Chapters)+1)
+		}
+		m.Chapters = append(m.Chapters, Chapter{Start: start, End: end, Title: title})
+	}
+}
+
+// StartText returns the start time formatted as H:MM:SS or M:SS
+func (c Chapter) StartText() string {
+	return formatDuration(c.Start)
+}
+
+// StartSeconds returns the start time for the player (e.g. 62.5)
+func (c Chapter) StartSeconds() string {
+	return strconv.FormatFloat(c.Start, 'f', -1, 64)
+}
+
+// chaptersWebVTT writes the chapters as a WebVTT chapters track
+func chaptersWebVTT(chapters []Chapter) []byte {
+	cues := make([]webvttCue, len(chapters))
+	for i, chapter := range chapters {
+		cues[i] = webvttCue{
+			start: time.Duration(chapter.Start * float64(time.Second)),
+			end:   time.Duration(chapter.End * float64(time.Second)),
+			text:  chapter.Title,
+		}
+	}
+	return formatWebVTT(cues)
+}
+
+// generateChapters writes the chapters of every video that has some as a
+// WebVTT track the player reads. Files are only rewritten when the
+// chapters change.
+func (g *Generator) generateChapters() error {
+	dir := filepath.Join(g.outputDir, chapterDir)
+	keep := make(map[string]bool)
+
+	for _, video := range g.videos {
+		if len(video.Chapters) == 0 {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+
+		fileName := fileSlug(video.RelativePath) + ".vtt"
+		vttPath := filepath.Join(dir, fileName)
+		keep[fileName] = true
+
+		vtt := chaptersWebVTT(video.Chapters)
+		if existing, err := os.ReadFile(vttPath); err != nil || !bytes.Equal(existing, vtt) {
+			if err := os.WriteFile(vttPath, vtt, 0644); err != nil {
+				fmt.Printf("  Warning: Error writing chapters for %s: %v\n", video.FileName, err)
+				continue
+			}
+		}
+		video.ChapterTrack = chapterDir + "/" + fileName
+
+		if video.ChapterSpacing > 0 {
+			g.generateChapterThumbnails(video, dir, keep)
+		}
+	}
+
+	_, err := pruneFiles(dir, chapterPatterns, keep)
+	return err
+}
+
+// ChaptersText returns the number of chapters (e.g. "12 chapters"), empty without chapters
+func (v *Video) ChaptersText() string {
+	switch {
+	case len(v.Chapters) == 0:
+		return ""
+	case v.ChapterSpacing > 0:
+		return fmt.Sprintf("%d chapters (detected)", len(v.Chapters))
+	default:
+		return fmt.Sprintf("%d chapters", len(v.Chapters))
+	}
+}
@@ -0,0 +1,118 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Browser compatibility matrix: what current Chrome, Firefox, Safari and
+// Edge can all decode. Anything else probably won't play in at least one of
+// them (e.g. HEVC only plays in Safari and on some hardware, Theora isn't
+// supported by Safari or Chrome, and Vorbis and FLAC are unreliable in Safari).
+var (
+	browserVideoCodecs = map[string]bool{
+		"h264": true,
+		"vp8":  true,
+		"vp9":  true,
+		"av1":  true,
+	}
+	browserAudioCodecs = map[string]bool{
+		"aac":  true,
+		"mp3":  true,
+		"opus": true,
+	}
+	// 8-bit 4:2:0 is the only pixel format decoded everywhere
+	browserPixelFormats = map[string]bool{
+		"yuv420p":  true,
+		"yuvj420p": true,
+	}
+	// H.264 profiles with hardware and software decoders in every browser
+	// (High 10, High 4:2:2 and High 4:4:4 are not among them)
+	browserH264Profiles = map[string]bool{
+		"baseline":             true,
+		"constrained baseline": true,
+		"main":                 true,
+		"high":                 true,
+	}
+)
+
+// Codec names shown to users, when ffprobe's name isn't self-explanatory
+var codecDisplayNames = map[string]string{
+	"hevc":       "HEVC (H.265)",
+	"mpeg4":      "MPEG-4 Part 2",
+	"msmpeg4v3":  "MS MPEG-4 v3",
+	"mpeg2video": "MPEG-2",
+	"wmv3":       "WMV 9",
+	"ac3":        "AC-3 (Dolby Digital)",
+	"eac3":       "E-AC-3 (Dolby Digital Plus)",
+	"dts":        "DTS",
+	"truehd":     "Dolby TrueHD",
+	"wmav2":      "WMA",
+
+	"hdmv_pgs_subtitle": "PGS",
+	"dvd_subtitle":      "VobSub",
+	"dvb_subtitle":      "DVB",
+}
+
+// codecDisplayName returns a readable name for a codec reported by ffprobe
+func codecDisplayName(codec string) string {
+	if name, ok := codecDisplayNames[codec]; ok {
+		return name
+	}
+	return codec
+}
+
+// videoIssue explains why a video stream probably won't play in browsers,
+// or returns "" if it should. Empty values (not probed) are not reported.
+func videoIssue(codec, profile, pixFmt string) string {
+	if codec == "" {
+		return ""
+	}
+	if !browserVideoCodecs[codec] {
+		return fmt.Sprintf("%s video is not supported by most browsers", codecDisplayName(codec))
+	}
+	if pixFmt != "" && !browserPixelFormats[pixFmt] {
+		return fmt.Sprintf("Pixel format %s (e.g. 10-bit or 4:4:4) is not supported by most browsers", pixFmt)
+	}
+	if codec == "h264" && profile != "" && !browserH264Profiles[strings.ToLower(profile)] {
+		return fmt.Sprintf("H.264 %s profile is not supported by most browsers", profile)
+	}
+	return ""
+}
+
+// audioIssue explains why an audio stream probably won't play in browsers,
+// or returns "" if it should
+func audioIssue(codec string) string {
+	if codec == "" || browserAudioCodecs[codec] {
+		return ""
+	}
+	return fmt.Sprintf("%s audio is not supported by most browsers", codecDisplayName(codec))
+}
+
+// PlaybackIssues lists the reasons the video probably won't play in a
+// browser, based on its container and probed codecs. Without metadata only
+// the container is checked.
+func (v *Video) PlaybackIssues() []string {
+	var issues []string
+	if needsConversion[v.Extension] {
+		issues = append(issues, fmt.Sprintf("%s container is not supported by browsers", strings.ToUpper(strings.TrimPrefix(v.Extension, "."))))
+	}
+	return append(issues, v.codecIssues()...)
+}
+
+// Playable reports whether the video should play in browsers
+func (v *Video) Playable() bool {
+	return len(v.PlaybackIssues()) == 0
+}
+
+// codecIssues lists the problems with the probed streams
+func (m *Metadata) codecIssues() []string {
+	var issues []string
+	if issue := videoIssue(m.VideoCodec, m.VideoProfile, m.PixFmt); issue != "" {
+		issues = append(issues, issue)
+	}
+	if issue := audioIssue(m.AudioCodec); issue != "" {
+		issues = append(issues, issue)
+	}
+	return issues
+}
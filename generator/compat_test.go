@@ -0,0 +1,48 @@
+package generator
+
+import (
+	"testing"
+)
+
+func TestVideoIssue(t *testing.T) {
+	tests := []struct {
+		codec, profile, pixFmt string
+		playable               bool
+	}{
+		{"h264", "High", "yuv420p", true},
+		{"vp9", "Profile 0", "yuv420p", true},
+		{"av1", "Main", "yuv420p", true},
+		{"h264", "High 10", "yuv420p10le", false},
+		{"h264", "High 4:4:4 Predictive", "yuv420p", false},
+		{"hevc", "Main", "yuv420p", false},
+		{"theora", "", "yuv420p", false},
+		{"", "", "", true},
+	}
+
+	for _, tt := range tests {
+		if issue := videoIssue(tt.codec, tt.profile, tt.pixFmt); (issue == "") != tt.playable {
+			t.Errorf("videoIssue(%q, %q, %q) = %q, want playable %v", tt.codec, tt.profile, tt.pixFmt, issue, tt.playable)
+		}
+	}
+}
+
+func TestAudioIssue(t *testing.T) {
+	tests := []struct {
+		codec    string
+		playable bool
+	}{
+		{"aac", true},
+		{"mp3", true},
+		{"opus", true},
+		{"vorbis", false},
+		{"flac", false},
+		{"ac3", false},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		if issue := audioIssue(tt.codec); (issue == "") != tt.playable {
+			t.Errorf("audioIssue(%q) = %q, want playable %v", tt.codec, issue, tt.playable)
+		}
+	}
+}
@@ -0,0 +1,735 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Number of ffmpeg output lines shown when a conversion fails
+const failureLogLines = 10
+
+// Suffix added to a file replaced by its converted version (e.g. movie.mp4.orig)
+const originalSuffix = ".orig"
+
+// Prefix of the temporary file a video is converted into when it replaces
+// the source (e.g. .converting-movie.mp4)
+const convertingPrefix = ".converting-"
+
+// A temporary conversion file not written to for this long (or for the
+// stall timeout, if longer) is left from an interrupted conversion. Newer
+// ones may belong to a conversion still running in another vsite.
+const staleConvertingAge = 10 * time.Minute
+
+// A video that hits the encoder session limit is queued again up to this
+// many times, then converted with the software encoder
+const maxSessionRetries = 5
+
+// How long the last worker waits before retrying after hitting the session
+// limit (a variable so tests can shorten it)
+var sessionRetryDelay = 15 * time.Second
+
+// ConvertOptions configures ConvertVideos
+type ConvertOptions struct {
+	Encoder       string        // Encoder backend name (default: software encoder for the profile codec)
+	Format        string        // Output format name (default: the one for the profile codec)
+	Jobs          int           // Number of conversions running at the same time (default: 1)
+	StallTimeout  time.Duration // Kill ffmpeg after this long without progress (0 to disable)
+	Profile       Profile       // Encoding settings (default: DefaultProfile)
+	AudioLanguage string        // Audio track marked as default when a video has several (e.g. en, pt-BR)
+}
+
+// conversionResult is the outcome of converting a single video
+type conversionResult struct {
+	source   string        // Original file
+	output   string        // Converted file
+	method   string        // How streams were handled (e.g. "remux", "copy video, transcode audio")
+	encoder  string        // Encoder backend used for the video, "copy" when it was copied
+	err      error         // Conversion error, nil on success
+	stalled  bool          // ffmpeg was stopped for making no progress
+	log      string        // ffmpeg output (kept for failures)
+	duration time.Duration // Time spent converting
+
+	fallbackFrom string // Hardware encoder that failed before the software one was used
+
+	subtitles        []string // Subtitle sidecars extracted from the source
+	skippedSubtitles []string // Subtitle streams that couldn't be extracted, described
+	subtitleErr      error    // Error extracting the subtitles (the video is still converted)
+}
+
+// summary describes how the video was converted
+// (e.g. "transcode video, copy audio, libx264 after nvenc failed")
+func (r conversionResult) summary() string {
+	switch {
+	case r.encoder == "copy":
+		return r.method
+	case r.fallbackFrom != "":
+		return r.method + ", " + r.encoder + " after " + r.fallbackFrom + " failed"
+	default:
+		return r.method + ", " + r.encoder
+	}
+}
+
+// reason returns the most useful explanation of a failure: ffmpeg's last
+// output line, or the error itself
+func (r conversionResult) reason() string {
+	if lines := lastLines(r.log, 1); len(lines) > 0 && !r.stalled {
+		return lines[0]
+	}
+	return fmt.Sprint(r.err)
+}
+
+// ConvertVideos converts incompatible videos to MP4 (or WebM) using ffmpeg
+func (g *Generator) ConvertVideos(opts ConvertOptions) error {
+	// Check if ffmpeg is installed
+	if _, err := g.runner.LookPath("ffmpeg"); err != nil {
+		return fmt.Errorf("ffmpeg not found. Install with:\n  Debian/Ubuntu: sudo apt install ffmpeg\n  Fedora/RHEL:   sudo dnf install ffmpeg")
+	}
+
+	if opts.Profile.Name == "" {
+		opts.Profile = DefaultProfile()
+	}
+	// --format decides the codec, whatever the profile says
+	if opts.Format != "" {
+		format, err := findFormat(opts.Format)
+		if err != nil {
+			return err
+		}
+		opts.Profile.Codec = format.codec
+	}
+	format := formatForCodec(opts.Profile.Codec)
+	fmt.Printf("Profile: %s (%s)\n", opts.Profile.Name, opts.Profile.Summary())
+	fmt.Printf("Format: %s\n", format.description)
+
+	// Check the encoder can run here (e.g. GPU and driver present)
+	enc, err := findEncoder(opts.Encoder, opts.Profile.Codec)
+	if err != nil {
+		return err
+	}
+	if err := enc.Available(g.runner); err != nil {
+		return err
+	}
+	fmt.Printf("Encoder: %s\n", enc.Description())
+
+	fmt.Println("Searching for videos to convert...")
+
+	toConvert, err := g.findConversionCandidates(format, max(opts.StallTimeout, staleConvertingAge))
+	if err != nil {
+		return err
+	}
+
+	if len(toConvert) == 0 {
+		fmt.Println("No videos need conversion.")
+		return nil
+	}
+
+	jobs := opts.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > len(toConvert) {
+		jobs = len(toConvert)
+	}
+
+	if jobs > 1 {
+		fmt.Printf("Found %d videos to convert (%d parallel jobs)\n", len(toConvert), jobs)
+	} else {
+		fmt.Printf("Found %d videos to convert\n", len(toConvert))
+	}
+
+	// Streams decide what can be copied; durations are needed for percentages and ETAs
+	plans, durations := probeSources(g.runner, toConvert, opts.Profile, format, opts.AudioLanguage)
+	display := newProgressDisplay("Converting", durations)
+
+	// Software encoder retried when a hardware encode fails
+	var fallback Encoder
+	if enc.Hardware() {
+		fallback = g.softwareFallback(opts.Profile.Codec)
+	}
+
+	// Worker pool: each worker takes the next pending video. Videos can be
+	// queued again (encoder session limit), so the queue holds all of them
+	// and is closed once every video is done.
+	// Output of each ffmpeg process is captured so lines never interleave.
+	results := make([]conversionResult, len(toConvert))
+	sessionRetries := make([]int, len(toConvert))
+	pending := make(chan int, len(toConvert))
+	for i := range toConvert {
+		pending <- i
+	}
+	var remaining, workers atomic.Int64
+	remaining.Store(int64(len(toConvert)))
+	workers.Store(int64(jobs))
+	// Workers paused by the session limit wait for resume, which is signaled
+	// when a video queued again converts (so sessions are free again), or
+	// for done once every video is done
+	resume := make(chan struct{})
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	for range jobs {
+		wg.Go(func() {
+			for i := range pending {
+				videoPath := toConvert[i]
+				job := display.start(i, filepath.Base(videoPath), durations[i])
+				onProgress := func(outTime, speed float64) {
+					display.update(job, outTime, speed)
+				}
+
+				result := convertVideo(g.runner, videoPath, plans[i], enc, opts, onProgress)
+
+				// Too many encodes on the GPU: try again once another one finishes.
+				// This worker pauses until a video queued again converts (the
+				// last worker waits a while instead), so one job less runs meanwhile.
+				if result.err != nil && sessionLimitReached(enc, result.log) && sessionRetries[i] < maxSessionRetries {
+					sessionRetries[i]++
+					display.requeue(job, fmt.Sprintf("%s %s session limit reached, queued again: %s", job.prefix, enc.Name(), job.name))
+					pending <- i
+					if workers.Add(-1) > 0 {
+						select {
+						case <-resume:
+							workers.Add(1)
+							continue
+						case <-done:
+							return
+						}
+					}
+					workers.Add(1)
+					time.Sleep(sessionRetryDelay)
+					continue
+				}
+
+				// Hardware encoders reject some inputs (pixel formats, resolutions)
+				if result.err != nil && fallback != nil && !plans[i].copyVideo && !result.stalled {
+					display.restart(job, fmt.Sprintf("%s %s failed: %s: %s, retrying with %s", job.prefix, enc.Name(), job.name, result.reason(), fallback.Name()))
+					result = convertVideo(g.runner, videoPath, plans[i], fallback, opts, onProgress)
+					result.fallbackFrom = enc.Name()
+				}
+				results[i] = result
+
+				if result.err != nil {
+					display.finish(job,
+						fmt.Sprintf("%s Failed: %s: %v", job.prefix, job.name, result.err),
+						lastLines(result.log, failureLogLines))
+				} else {
+					display.finish(job,
+						fmt.Sprintf("%s Done: %s (%s, %s)", job.prefix, filepath.Base(result.output), result.summary(), result.duration.Round(time.Second)),
+						nil)
+				}
+
+				// A session became available: bring back a paused worker, if any
+				if result.err == nil && sessionRetries[i] > 0 {
+					select {
+					case resume <- struct{}{}:
+					default:
+					}
+				}
+
+				if remaining.Add(-1) == 0 {
+					close(pending)
+					close(done)
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	printConversionSummary(results)
+
+	if err := g.recordConversions(results, opts.Profile); err != nil {
+		fmt.Printf("Warning: Error saving conversion records: %v\n", err)
+	}
+	return nil
+}
+
+// softwareFallback returns the software encoder for codec, or nil (with a
+// warning) if it can't run, in which case failed hardware encodes aren't retried
+func (g *Generator) softwareFallback(codec string) Encoder {
+	fallback, err := findEncoder("", codec)
+	if err == nil {
+		err = fallback.Available(g.runner)
+	}
+	if err != nil {
+		fmt.Printf("Warning: No software fallback for failed hardware encodes: %v\n", err)
+		return nil
+	}
+	return fallback
+}
+
+// findConversionCandidates returns videos that probably won't play in
+// browsers and haven't been converted to format yet: incompatible containers, and
+// (when ffprobe is available) files with incompatible codecs, such as HEVC
+// or 10-bit video and AC-3 audio in an MP4. Probed metadata is shared with
+// the generator through the metadata cache. Temporary conversion files
+// not modified for staleAfter are removed.
+func (g *Generator) findConversionCandidates(format outputFormat, staleAfter time.Duration) ([]string, error) {
+	var toConvert []string
+	inProgress := make(map[string]bool) // Sources being converted in place by another run
+
+	cache := loadCache(filepath.Join(g.outputDir, cacheFile))
+	_, err := g.runner.LookPath("ffprobe")
+	canProbe := err == nil
+	excluded := g.excludedDir()
+
+	// Scan directory for videos that need conversion
+	err = filepath.Walk(g.rootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if path != g.rootDir && (strings.HasPrefix(info.Name(), ".") || isDir(path, excluded)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Skip hidden files, removing temporary files left by an interrupted conversion
+		if strings.HasPrefix(info.Name(), ".") {
+			if !strings.HasPrefix(info.Name(), convertingPrefix) {
+				return nil
+			}
+			source := filepath.Join(filepath.Dir(path), strings.TrimPrefix(info.Name(), convertingPrefix))
+			if time.Since(info.ModTime()) < staleAfter {
+				fmt.Printf("Skipping %s: another conversion may be in progress\n", source)
+				inProgress[source] = true
+			} else if err := os.Remove(path); err != nil {
+				fmt.Printf("  Warning: Error removing %s: %v\n", path, err)
+			} else {
+				fmt.Printf("Removed stale temporary file: %s\n", path)
+			}
+			return nil
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+		if !needsConversion[ext] && !videoExtensions[ext] {
+			return nil
+		}
+
+		// Check if a converted version already exists
+		if ext != format.extension {
+			if _, err := os.Stat(strings.TrimSuffix(path, ext) + format.extension); err == nil {
+				return nil
+			}
+		}
+
+		if needsConversion[ext] {
+			toConvert = append(toConvert, path)
+			return nil
+		}
+
+		// Compatible container: check the codecs
+		if !canProbe {
+			return nil
+		}
+		relPath, err := filepath.Rel(g.rootDir, path)
+		if err != nil {
+			return err
+		}
+		var metadata Metadata
+		if entry, ok := cache.lookup(relPath, info); ok {
+			metadata = entry.Metadata
+		} else {
+			probe, err := probeFile(g.runner, path)
+			if err != nil {
+				fmt.Printf("  Warning: Error probing %s: %v\n", info.Name(), err)
+				return nil
+			}
+			metadata.applyProbe(probe)
+			cache.store(relPath, info, metadata)
+		}
+
+		if issues := metadata.codecIssues(); len(issues) > 0 {
+			fmt.Printf("  %s: %s\n", relPath, strings.Join(issues, "; "))
+			toConvert = append(toConvert, path)
+		}
+		return nil
+	})
+
+	if err := cache.save(); err != nil {
+		fmt.Printf("Warning: Error saving metadata cache: %v\n", err)
+	}
+	toConvert = slices.DeleteFunc(toConvert, func(path string) bool { return inProgress[path] })
+	return toConvert, err
+}
+
+// probeSources probes each video, returning its conversion plan and its
+// duration in seconds. When a video can't be probed (e.g. ffprobe is not
+// installed), every stream is transcoded and the duration is 0.
+func probeSources(r Runner, paths []string, profile Profile, format outputFormat, audioLang string) ([]conversionPlan, []float64) {
+	plans := make([]conversionPlan, len(paths))
+	durations := make([]float64, len(paths))
+	for i := range plans {
+		plans[i].format = format
+	}
+	if _, err := r.LookPath("ffprobe"); err != nil {
+		return plans, durations
+	}
+
+	for i, path := range paths {
+		probe, err := probeFile(r, path)
+		if err != nil {
+			fmt.Printf("  Warning: Error probing %s: %v\n", filepath.Base(path), err)
+			continue
+		}
+		var metadata Metadata
+		metadata.applyProbe(probe)
+		durations[i] = metadata.Duration
+		plans[i] = planConversion(probe, profile, format, audioLang)
+	}
+	return plans, durations
+}
+
+// conversionPlan decides, per stream, whether it is copied or transcoded
+type conversionPlan struct {
+	format       outputFormat // Container and codecs produced
+	video        *probeStream // Main video stream, nil if unknown
+	audio        []audioPlan  // Audio streams, in file order
+	copyVideo    bool         // Video is browser-compatible and copied as-is
+	audioDefault int          // Position in audio of the track marked as default
+
+	subtitles        []*probeStream // Text subtitles, extracted as WebVTT sidecars
+	skippedSubtitles []*probeStream // Image-based subtitles, which can't be extracted
+}
+
+// audioPlan decides how a single audio stream is handled
+type audioPlan struct {
+	stream *probeStream
+	copy   bool // Browser-compatible and copied as-is
+}
+
+// planConversion chooses the streams to keep and which of them can be
+// copied: streams browsers play that fit in the format and are within the
+// profile limits
+func planConversion(probe *probeOutput, profile Profile, format outputFormat, audioLang string) conversionPlan {
+	plan := conversionPlan{
+		format: format,
+		video:  probe.videoStream(),
+	}
+	if video := plan.video; video != nil {
+		plan.copyVideo = format.copyVideo[video.CodecName] && video.CodecName == profile.Codec &&
+			videoIssue(video.CodecName, video.Profile, video.PixFmt) == "" && !profile.exceedsVideo(video)
+	}
+	audio := probe.audioStreams()
+	for _, stream := range audio {
+		plan.audio = append(plan.audio, audioPlan{
+			stream: stream,
+			copy:   format.copyAudio[stream.CodecName] && audioIssue(stream.CodecName) == "" && !profile.exceedsAudio(stream),
+		})
+	}
+	plan.audioDefault = defaultAudioStream(audio, audioLang)
+	for _, stream := range probe.subtitleStreams() {
+		if textSubtitleCodecs[stream.CodecName] {
+			plan.subtitles = append(plan.subtitles, stream)
+		} else {
+			plan.skippedSubtitles = append(plan.skippedSubtitles, stream)
+		}
+	}
+	return plan
+}
+
+// describe summarizes how the streams are handled
+func (p conversionPlan) describe() string {
+	copyAudio := true
+	for _, audio := range p.audio {
+		copyAudio = copyAudio && audio.copy
+	}
+	switch {
+	case p.video == nil:
+		return "transcode"
+	case p.copyVideo && copyAudio:
+		return "remux"
+	case p.copyVideo:
+		return "copy video, transcode audio"
+	case len(p.audio) > 0 && copyAudio:
+		return "transcode video, copy audio"
+	default:
+		return "transcode"
+	}
+}
+
+// convertVideo converts a single video to the plan format with enc, removing the
+// partial output on failure. Progress is reported through onProgress; ffmpeg
+// is killed if it makes no progress for opts.StallTimeout.
+//
+// A source already in the format's container (e.g. an HEVC MP4) is converted
+// into a temporary file that replaces it on success; the original is kept
+// next to it with originalSuffix.
+func convertVideo(r Runner, videoPath string, plan conversionPlan, enc Encoder, opts ConvertOptions, onProgress func(outTime, speed float64)) conversionResult {
+	ext := filepath.Ext(videoPath)
+	outPath := strings.TrimSuffix(videoPath, ext) + plan.format.extension
+	result := conversionResult{source: videoPath, output: outPath, method: plan.describe(), encoder: enc.Name()}
+	if plan.copyVideo {
+		result.encoder = "copy"
+	}
+
+	inPlace := outPath == videoPath
+	if inPlace {
+		// Hidden, so scans skip it while converting
+		outPath = filepath.Join(filepath.Dir(videoPath), convertingPrefix+filepath.Base(videoPath))
+		os.Remove(outPath)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	args := append([]string{"-progress", "pipe:1", "-nostats"}, ffmpegArgs(videoPath, outPath, plan, opts.Profile, enc)...)
+	cmd := r.Command(ctx, "ffmpeg", args...)
+	// Don't wait for output pipes held open by a killed process
+	cmd.WaitDelay = time.Second
+
+	var output bytes.Buffer
+	cmd.Stderr = &output
+	progress, err := cmd.StdoutPipe()
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		result.err = err
+		return result
+	}
+
+	// Watchdog: kill ffmpeg when the processed media time stops advancing
+	advanced := make(chan struct{}, 1)
+	finished := make(chan struct{})
+	var stalled atomic.Bool
+	if opts.StallTimeout > 0 {
+		go func() {
+			timer := time.NewTimer(opts.StallTimeout)
+			defer timer.Stop()
+			for {
+				select {
+				case <-advanced:
+					timer.Reset(opts.StallTimeout)
+				case <-timer.C:
+					stalled.Store(true)
+					cancel()
+					// Unblock the progress reader even if the pipe is still held open
+					progress.Close()
+					return
+				case <-finished:
+					return
+				}
+			}
+		}()
+	}
+
+	lastOutTime := -1.0
+	readProgress(progress, func(outTime, speed float64) {
+		if outTime > lastOutTime {
+			lastOutTime = outTime
+			select {
+			case advanced <- struct{}{}:
+			default:
+			}
+		}
+		onProgress(outTime, speed)
+	})
+
+	err = cmd.Wait()
+	close(finished)
+	result.duration = time.Since(start)
+
+	if stalled.Load() {
+		result.stalled = true
+		err = fmt.Errorf("stalled: no progress for %s", opts.StallTimeout)
+	}
+	if err != nil {
+		result.err = err
+		result.log = output.String()
+		// Remove partial file if exists
+		os.Remove(outPath)
+		return result
+	}
+
+	source := videoPath
+	if inPlace {
+		if err := replaceOriginal(videoPath, outPath); err != nil {
+			result.err = err
+			os.Remove(outPath)
+			return result
+		}
+		source += originalSuffix
+	}
+
+	// Subtitle streams aren't kept in the converted file: text ones become
+	// sidecars the player offers, image-based ones are reported as skipped
+	if len(plan.subtitles) > 0 {
+		result.subtitles, result.subtitleErr = extractSubtitles(r, source, strings.TrimSuffix(videoPath, ext), plan.subtitles)
+	}
+	for _, stream := range plan.skippedSubtitles {
+		result.skippedSubtitles = append(result.skippedSubtitles, describeSubtitleStream(stream))
+	}
+
+	return result
+}
+
+// replaceOriginal moves the original file aside and puts the converted file in its place
+func replaceOriginal(videoPath, convertedPath string) error {
+	if err := os.Rename(videoPath, videoPath+originalSuffix); err != nil {
+		return fmt.Errorf("error keeping original: %w", err)
+	}
+	if err := os.Rename(convertedPath, videoPath); err != nil {
+		// Put the original back
+		os.Rename(videoPath+originalSuffix, videoPath)
+		return fmt.Errorf("error replacing original: %w", err)
+	}
+	return nil
+}
+
+// ffmpegArgs builds the ffmpeg arguments to convert src into the plan
+// format at dst with the profile settings and encoder. Streams the plan marks as
+// compatible are copied; the rest are transcoded.
+func ffmpegArgs(src, dst string, plan conversionPlan, profile Profile, enc Encoder) []string {
+	transcodeVideo := !plan.copyVideo
+	filters := videoFilters(plan, profile)
+	args := []string{"-hide_banner"}
+
+	if transcodeVideo {
+		args = append(args, enc.InputArgs(len(filters) > 0)...)
+	}
+	args = append(args, "-i", src)
+
+	// Keep the streams the plan was made for (otherwise ffmpeg picks its own)
+	if plan.video != nil {
+		args = append(args, "-map", fmt.Sprintf("0:%d", plan.video.Index))
+		for _, audio := range plan.audio {
+			args = append(args, "-map", fmt.Sprintf("0:%d", audio.stream.Index))
+		}
+	}
+
+	if transcodeVideo {
+		args = append(args, enc.OutputArgs(profile, filters)...)
+	} else {
+		args = append(args, "-c:v", "copy")
+	}
+
+	if plan.video == nil {
+		// Streams unknown: ffmpeg picks a single audio stream
+		args = append(args, "-c:a", plan.format.audioCodec, "-b:a", profile.AudioBitrate)
+	} else {
+		for i, audio := range plan.audio {
+			args = append(args, audioArgs(i, audio, i == plan.audioDefault, plan.format, profile)...)
+		}
+	}
+
+	args = append(args, plan.format.muxerArgs...)
+	return append(args, "-y", dst)
+}
+
+// audioArgs returns the options for the i-th output audio stream: its
+// codec, and the language and title of the source so the player can label
+// it. Only the default track plays in browsers that can't switch tracks.
+func audioArgs(i int, audio audioPlan, isDefault bool, format outputFormat, profile Profile) []string {
+	stream := fmt.Sprintf(":a:%d", i)
+	var args []string
+	if audio.copy {
+		args = append(args, "-c"+stream, "copy")
+	} else {
+		args = append(args, "-c"+stream, format.audioCodec, "-b"+stream, profile.AudioBitrate)
+		if profile.exceedsAudio(audio.stream) {
+			args = append(args, "-ac"+stream, strconv.Itoa(profile.AudioChannels))
+		}
+	}
+
+	if lang := audio.stream.Tags["language"]; lang != "" {
+		args = append(args, "-metadata:s"+stream, "language="+lang)
+	}
+	if title := audio.stream.Tags["title"]; title != "" {
+		// MP4 players read the track name from the handler
+		args = append(args, "-metadata:s"+stream, "title="+title, "-metadata:s"+stream, "handler_name="+title)
+	}
+
+	disposition := "0"
+	if isDefault {
+		disposition = "default"
+	}
+	return append(args, "-disposition"+stream, disposition)
+}
+
+// videoFilters returns the filters applying the profile resolution and frame rate caps
+func videoFilters(plan conversionPlan, profile Profile) []string {
+	var filters []string
+	if profile.MaxHeight > 0 {
+		// Never upscale; the width keeps the aspect ratio (rounded to even)
+		filters = append(filters, fmt.Sprintf("scale=-2:'min(%d,ih)'", profile.MaxHeight))
+	}
+	// Only reduce known higher frame rates, the fps filter would also raise lower ones
+	if profile.MaxFPS > 0 && plan.video != nil && plan.video.frameRate() > profile.MaxFPS {
+		filters = append(filters, "fps="+formatFrameRate(profile.MaxFPS))
+	}
+	return filters
+}
+
+// printConversionSummary lists converted and failed videos
+func printConversionSummary(results []conversionResult) {
+	var succeeded, failed []conversionResult
+	for _, result := range results {
+		if result.err != nil {
+			failed = append(failed, result)
+		} else {
+			succeeded = append(succeeded, result)
+		}
+	}
+
+	fmt.Println()
+	fmt.Printf("Conversion completed! %d succeeded, %d failed\n", len(succeeded), len(failed))
+
+	if len(succeeded) > 0 {
+		fmt.Println("Converted:")
+		for _, result := range succeeded {
+			fmt.Printf("  OK    %s (%s)\n", filepath.Base(result.source), result.summary())
+		}
+	}
+	if len(failed) > 0 {
+		fmt.Println("Failed:")
+		for _, result := range failed {
+			fmt.Printf("  FAIL  %s (%v)\n", filepath.Base(result.source), result.err)
+		}
+	}
+
+	var subtitleLines []string
+	for _, result := range succeeded {
+		source := filepath.Base(result.source)
+		for _, path := range result.subtitles {
+			subtitleLines = append(subtitleLines, fmt.Sprintf("  OK    %s (from %s)", filepath.Base(path), source))
+		}
+		if result.subtitleErr != nil {
+			subtitleLines = append(subtitleLines, fmt.Sprintf("  FAIL  %s (%v)", source, result.subtitleErr))
+		}
+		for _, stream := range result.skippedSubtitles {
+			subtitleLines = append(subtitleLines, fmt.Sprintf("  SKIP  %s: %s (image-based, can't be converted to WebVTT)", source, stream))
+		}
+	}
+	if len(subtitleLines) > 0 {
+		fmt.Println("Subtitles:")
+		for _, line := range subtitleLines {
+			fmt.Println(line)
+		}
+	}
+}
+
+// lastLines returns up to n non-empty trailing lines of s
+func lastLines(s string, n int) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(s), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
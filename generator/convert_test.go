@@ -0,0 +1,329 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// ffprobe output of an HEVC video with stereo AAC audio, which --convert
+// transcodes to H.264 copying the audio
+const hevcProbe = `{
+	"streams": [
+		{"index": 0, "codec_type": "video", "codec_name": "hevc", "profile": "Main", "pix_fmt": "yuv420p", "width": 1920, "height": 1080, "avg_frame_rate": "24/1"},
+		{"index": 1, "codec_type": "audio", "codec_name": "aac", "channels": 2, "tags": {"language": "eng"}, "disposition": {"default": 1}}
+	],
+	"format": {"duration": "10.000000", "bit_rate": "4000000"}
+}`
+
+func TestFFmpegArgs(t *testing.T) {
+	mp4, _ := findFormat("mp4")
+	webm, _ := findFormat("webm")
+
+	hevc := &probeStream{Index: 0, CodecType: "video", CodecName: "hevc", Height: 2160}
+	h264 := &probeStream{Index: 0, CodecType: "video", CodecName: "h264", Height: 1080}
+	english := &probeStream{Index: 1, CodecType: "audio", CodecName: "aac", Channels: 2, Tags: map[string]string{"language": "eng"}}
+	surround := &probeStream{Index: 1, CodecType: "audio", CodecName: "ac3", Channels: 6}
+	commentary := &probeStream{Index: 2, CodecType: "audio", CodecName: "aac", Channels: 2, Tags: map[string]string{"title": "Commentary"}}
+
+	capped := DefaultProfile()
+	capped.MaxHeight = 720
+	capped.AudioChannels = 2
+
+	tests := []struct {
+		name    string
+		plan    conversionPlan
+		profile Profile
+		enc     Encoder
+		want    []string
+	}{
+		{
+			name:    "transcode video, copy audio",
+			plan:    conversionPlan{format: mp4, video: hevc, audio: []audioPlan{{stream: english, copy: true}}},
+			profile: DefaultProfile(),
+			enc:     libx264Encoder{},
+			want: []string{"-hide_banner", "-i", "in.mkv", "-map", "0:0", "-map", "0:1",
+				"-c:v", "libx264", "-preset", "fast", "-crf", "22", "-pix_fmt", "yuv420p",
+				"-c:a:0", "copy", "-metadata:s:a:0", "language=eng", "-disposition:a:0", "default",
+				"-movflags", "+faststart", "-y", "out.mp4"},
+		},
+		{
+			// Copied video isn't decoded, so the encoder's input options are left out
+			name:    "remux",
+			plan:    conversionPlan{format: mp4, video: h264, copyVideo: true, audio: []audioPlan{{stream: english, copy: true}}},
+			profile: DefaultProfile(),
+			enc:     nvencEncoder{},
+			want: []string{"-hide_banner", "-i", "in.mkv", "-map", "0:0", "-map", "0:1",
+				"-c:v", "copy",
+				"-c:a:0", "copy", "-metadata:s:a:0", "language=eng", "-disposition:a:0", "default",
+				"-movflags", "+faststart", "-y", "out.mp4"},
+		},
+		{
+			name: "hardware encode with filters and several audio tracks",
+			plan: conversionPlan{format: mp4, video: hevc, audioDefault: 1, audio: []audioPlan{
+				{stream: surround},
+				{stream: commentary, copy: true},
+			}},
+			profile: capped,
+			enc:     nvencEncoder{},
+			want: []string{"-hide_banner", "-hwaccel", "cuda", "-i", "in.mkv", "-map", "0:0", "-map", "0:1", "-map", "0:2",
+				"-c:v", "h264_nvenc", "-preset", "p4", "-cq", "23", "-vf", "scale=-2:'min(720,ih)'",
+				"-c:a:0", "aac", "-b:a:0", "128k", "-ac:a:0", "2", "-disposition:a:0", "0",
+				"-c:a:1", "copy", "-metadata:s:a:1", "title=Commentary", "-metadata:s:a:1", "handler_name=Commentary", "-disposition:a:1", "default",
+				"-movflags", "+faststart", "-y", "out.mp4"},
+		},
+		{
+			// Not probed: ffmpeg picks the streams
+			name:    "unknown streams",
+			plan:    conversionPlan{format: webm},
+			profile: DefaultProfile(),
+			enc:     vp9Encoder{},
+			want: []string{"-hide_banner", "-i", "in.mkv",
+				"-c:v", "libvpx-vp9", "-deadline", "good", "-cpu-used", "3", "-row-mt", "1", "-crf", "31", "-b:v", "0", "-pix_fmt", "yuv420p",
+				"-c:a", "libopus", "-b:a", "128k", "-y", "out.webm"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ffmpegArgs("in.mkv", "out"+tt.plan.format.extension, tt.plan, tt.profile, tt.enc)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ffmpegArgs() =\n  %q\nwant\n  %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// newConversionLibrary creates a root directory holding MKV files named
+// after videos, which --convert always converts
+func newConversionLibrary(t *testing.T, videos ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, name := range videos {
+		if err := os.WriteFile(filepath.Join(root, name+".mkv"), []byte("source"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// convertLibrary runs ConvertVideos on root with r and returns the
+// conversion records
+func convertLibrary(t *testing.T, root string, r Runner, opts ConvertOptions) map[string]conversionRecord {
+	t.Helper()
+	g := New(root)
+	g.SetRunner(r)
+	if err := g.ConvertVideos(opts); err != nil {
+		t.Fatalf("ConvertVideos() = %v", err)
+	}
+	return loadConversions(filepath.Join(root, conversionsFile))
+}
+
+// assertConverted checks which videos of root were converted to MP4
+func assertConverted(t *testing.T, root string, records map[string]conversionRecord, videos []string, converted bool) {
+	t.Helper()
+	for _, name := range videos {
+		_, err := os.Stat(filepath.Join(root, name+".mp4"))
+		if converted && err != nil {
+			t.Errorf("%s.mp4 not written: %v", name, err)
+		}
+		if !converted && err == nil {
+			t.Errorf("%s.mp4 left behind by a failed conversion", name)
+		}
+		if _, ok := records[name+".mp4"]; ok != converted {
+			t.Errorf("record of %s.mp4 present = %v, want %v", name, ok, converted)
+		}
+	}
+}
+
+func TestConvertVideos(t *testing.T) {
+	videos := []string{"first", "second", "third"}
+
+	t.Run("success", func(t *testing.T) {
+		root := newConversionLibrary(t, videos...)
+		r := &fakeRunner{env: []string{"FAKE_ENCODERS=libx264", "FAKE_PROBE=" + hevcProbe}}
+
+		records := convertLibrary(t, root, r, ConvertOptions{Jobs: 2})
+		assertConverted(t, root, records, videos, true)
+
+		for _, name := range videos {
+			record := records[name+".mp4"]
+			if record.Source != name+".mkv" || record.Encoder != "libx264" || record.Method != "transcode video, copy audio" || record.FallbackFrom != "" {
+				t.Errorf("record of %s.mp4 = %+v", name, record)
+			}
+		}
+		if got := r.encodes(); !slices.Equal(got, []string{"libx264", "libx264", "libx264"}) {
+			t.Errorf("encodes = %q, want three libx264 encodes", got)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		root := newConversionLibrary(t, videos...)
+		r := &fakeRunner{env: []string{"FAKE_ENCODERS=libx264", "FAKE_PROBE=" + hevcProbe, "FAKE_FAIL_ENCODER=libx264"}}
+
+		records := convertLibrary(t, root, r, ConvertOptions{Jobs: 2})
+		assertConverted(t, root, records, videos, false)
+
+		// Software encodes aren't retried
+		if got := r.encodes(); len(got) != len(videos) {
+			t.Errorf("encodes = %q, want one per video", got)
+		}
+	})
+
+	t.Run("stall", func(t *testing.T) {
+		root := newConversionLibrary(t, videos[0])
+		r := &fakeRunner{env: []string{"FAKE_ENCODERS=libx264", "FAKE_PROBE=" + hevcProbe, "FAKE_STALL=1"}}
+
+		start := time.Now()
+		records := convertLibrary(t, root, r, ConvertOptions{StallTimeout: 200 * time.Millisecond})
+		assertConverted(t, root, records, videos[:1], false)
+
+		if elapsed := time.Since(start); elapsed > 20*time.Second {
+			t.Errorf("stalled conversion stopped after %s", elapsed)
+		}
+	})
+}
+
+func TestConvertVideosFallback(t *testing.T) {
+	nvenc := []string{"FAKE_GPU=NVIDIA GeForce RTX 3060", "FAKE_ENCODERS=libx264 h264_nvenc", "FAKE_PROBE=" + hevcProbe}
+
+	t.Run("hardware failure", func(t *testing.T) {
+		videos := []string{"first", "second"}
+		root := newConversionLibrary(t, videos...)
+		r := &fakeRunner{env: append(nvenc, "FAKE_FAIL_ENCODER=h264_nvenc")}
+
+		records := convertLibrary(t, root, r, ConvertOptions{Encoder: "nvenc"})
+		assertConverted(t, root, records, videos, true)
+
+		for _, name := range videos {
+			if record := records[name+".mp4"]; record.Encoder != "libx264" || record.FallbackFrom != "nvenc" {
+				t.Errorf("record of %s.mp4 = %+v, want libx264 after nvenc", name, record)
+			}
+		}
+		want := []string{"h264_nvenc", "libx264", "h264_nvenc", "libx264"}
+		if got := r.encodes(); !slices.Equal(got, want) {
+			t.Errorf("encodes = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("stall", func(t *testing.T) {
+		// A stalled encode would likely stall again: not retried
+		root := newConversionLibrary(t, "first")
+		r := &fakeRunner{env: append(nvenc, "FAKE_STALL=1")}
+
+		records := convertLibrary(t, root, r, ConvertOptions{Encoder: "nvenc", StallTimeout: 200 * time.Millisecond})
+		assertConverted(t, root, records, []string{"first"}, false)
+
+		if got := r.encodes(); !slices.Equal(got, []string{"h264_nvenc"}) {
+			t.Errorf("encodes = %q, want a single h264_nvenc encode", got)
+		}
+	})
+}
+
+func TestConvertVideosSessionLimit(t *testing.T) {
+	delay := sessionRetryDelay
+	sessionRetryDelay = 10 * time.Millisecond
+	t.Cleanup(func() { sessionRetryDelay = delay })
+
+	nvenc := []string{"FAKE_GPU=NVIDIA GeForce RTX 3060", "FAKE_ENCODERS=libx264 h264_nvenc", "FAKE_PROBE=" + hevcProbe}
+
+	t.Run("requeue", func(t *testing.T) {
+		// Every video hits the limit once: all workers but the last pause,
+		// and resume as the videos queued again convert
+		videos := []string{"first", "second", "third"}
+		root := newConversionLibrary(t, videos...)
+		r := &fakeRunner{env: append(nvenc, "FAKE_SESSION_LIMIT=once")}
+
+		records := convertLibrary(t, root, r, ConvertOptions{Encoder: "nvenc", Jobs: 3})
+		assertConverted(t, root, records, videos, true)
+
+		for _, name := range videos {
+			if record := records[name+".mp4"]; record.Encoder != "nvenc" || record.FallbackFrom != "" {
+				t.Errorf("record of %s.mp4 = %+v, want nvenc", name, record)
+			}
+		}
+		if got := r.encodes(); len(got) != 2*len(videos) || slices.Contains(got, "libx264") {
+			t.Errorf("encodes = %q, want two h264_nvenc encodes per video", got)
+		}
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		root := newConversionLibrary(t, "first")
+		r := &fakeRunner{env: append(nvenc, "FAKE_SESSION_LIMIT=always")}
+
+		records := convertLibrary(t, root, r, ConvertOptions{Encoder: "nvenc", Jobs: 2})
+		assertConverted(t, root, records, []string{"first"}, true)
+
+		if record := records["first.mp4"]; record.Encoder != "libx264" || record.FallbackFrom != "nvenc" {
+			t.Errorf("record of first.mp4 = %+v, want libx264 after nvenc", record)
+		}
+		want := slices.Repeat([]string{"h264_nvenc"}, maxSessionRetries+1)
+		want = append(want, "libx264")
+		if got := r.encodes(); !slices.Equal(got, want) {
+			t.Errorf("encodes = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestCleanConverted(t *testing.T) {
+	root := newConversionLibrary(t, "movie")
+	if err := os.WriteFile(filepath.Join(root, "clip.mp4"), []byte("source"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRunner{env: []string{"FAKE_ENCODERS=libx264", "FAKE_PROBE=" + hevcProbe}}
+
+	records := convertLibrary(t, root, r, ConvertOptions{})
+	if records["movie.mp4"].Source != "movie.mkv" || records["clip.mp4"].Source != "clip.mp4"+originalSuffix {
+		t.Fatalf("records = %+v, want movie.mp4 from movie.mkv and clip.mp4 converted in place", records)
+	}
+
+	g := New(root)
+	g.SetRunner(r)
+	if _, err := g.CleanConverted(); err != nil {
+		t.Fatalf("CleanConverted() = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "movie.mp4")); err == nil {
+		t.Error("movie.mp4 not removed")
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "clip.mp4")); err != nil || string(data) != "source" {
+		t.Errorf("clip.mp4 = %q, %v; want the restored original", data, err)
+	}
+	if records := loadConversions(filepath.Join(root, conversionsFile)); len(records) != 0 {
+		t.Errorf("records left after cleaning: %+v", records)
+	}
+}
+
+func TestFindConversionCandidatesTempFiles(t *testing.T) {
+	root := newConversionLibrary(t, "movie")
+	for _, name := range []string{"clip.mp4", convertingPrefix + "clip.mp4", convertingPrefix + "old.mp4"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("source"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Left by a conversion interrupted an hour ago
+	hourAgo := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(root, convertingPrefix+"old.mp4"), hourAgo, hourAgo); err != nil {
+		t.Fatal(err)
+	}
+
+	g := New(root)
+	g.SetRunner(&fakeRunner{env: []string{"FAKE_PROBE=" + hevcProbe}})
+	candidates, err := g.findConversionCandidates(formatForCodec("h264"), staleConvertingAge)
+	if err != nil {
+		t.Fatalf("findConversionCandidates() = %v", err)
+	}
+
+	// clip.mp4 is being converted in place by another run
+	if want := []string{filepath.Join(root, "movie.mkv")}; !slices.Equal(candidates, want) {
+		t.Errorf("candidates = %q, want %q", candidates, want)
+	}
+	if _, err := os.Stat(filepath.Join(root, convertingPrefix+"clip.mp4")); err != nil {
+		t.Errorf("temporary file of a running conversion removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, convertingPrefix+"old.mp4")); err == nil {
+		t.Error("stale temporary file not removed")
+	}
+}
@@ -0,0 +1,304 @@
+package generator
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Encoder is a video encoder backend used by --convert. Each backend builds
+// its own ffmpeg arguments and knows how to check it can run on this machine.
+type Encoder interface {
+	// Name identifies the backend on the command line (e.g. nvenc)
+	Name() string
+	// Description is shown when converting (e.g. "NVIDIA NVENC (h264_nvenc)")
+	Description() string
+	// Codec is the video codec produced (see Profile.Codec)
+	Codec() string
+	// Hardware reports whether encoding runs on a GPU or media engine
+	Hardware() bool
+	// Available returns an error explaining what is missing to use the backend
+	Available(r Runner) error
+	// InputArgs are placed before the input (hardware decoding, devices).
+	// filtered is set when the video goes through filters.
+	InputArgs(filtered bool) []string
+	// OutputArgs select and configure the encoder, applying filters (may be empty)
+	OutputArgs(profile Profile, filters []string) []string
+}
+
+// Encoder backends, software encoders first
+var encoders = []Encoder{
+	libx264Encoder{},
+	svtav1Encoder{},
+	vp9Encoder{},
+	nvencEncoder{},
+	vaapiEncoder{},
+	qsvEncoder{},
+	videotoolboxEncoder{},
+}
+
+// EncoderNames returns the names of all encoder backends
+func EncoderNames() []string {
+	names := make([]string, len(encoders))
+	for i, enc := range encoders {
+		names[i] = enc.Name()
+	}
+	return names
+}
+
+// findEncoder returns the named backend, or the software encoder for codec
+// when name is empty. The backend must produce codec.
+func findEncoder(name, codec string) (Encoder, error) {
+	for _, enc := range encoders {
+		if name == "" && !enc.Hardware() && enc.Codec() == codec {
+			return enc, nil
+		}
+		if enc.Name() != name {
+			continue
+		}
+		if enc.Codec() != codec {
+			return nil, fmt.Errorf("encoder %s produces %s, but the output uses %s (use --format %s, or set \"codec\": \"%s\" in the profile)", name, enc.Codec(), codec, formatForCodec(enc.Codec()).name, enc.Codec())
+		}
+		return enc, nil
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no encoder for codec %s", codec)
+	}
+	return nil, fmt.Errorf("unknown encoder '%s' (available: %s)", name, strings.Join(EncoderNames(), ", "))
+}
+
+// sessionLimiter is implemented by encoders that limit concurrent encodes
+type sessionLimiter interface {
+	// sessionLimitReached reports whether ffmpeg failed because of the limit
+	sessionLimitReached(log string) bool
+}
+
+// sessionLimitReached reports whether the encode failed because enc was
+// already running as many sessions as it allows
+func sessionLimitReached(enc Encoder, log string) bool {
+	limiter, ok := enc.(sessionLimiter)
+	return ok && limiter.sessionLimitReached(log)
+}
+
+// checkFFmpegEncoder checks that ffmpeg was built with the named encoder
+func checkFFmpegEncoder(r Runner, name, hint string) error {
+	out, err := output(r, "ffmpeg", "-hide_banner", "-encoders")
+	if err != nil {
+		return fmt.Errorf("Error checking ffmpeg encoders: %v", err)
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 && fields[1] == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("ffmpeg does not have %s support.\n\n%s", name, hint)
+}
+
+// libx264Encoder encodes H.264 on the CPU
+type libx264Encoder struct{}
+
+func (libx264Encoder) Name() string        { return "libx264" }
+func (libx264Encoder) Description() string { return "CPU (libx264)" }
+func (libx264Encoder) Codec() string       { return "h264" }
+func (libx264Encoder) Hardware() bool      { return false }
+
+func (libx264Encoder) Available(r Runner) error {
+	return checkFFmpegEncoder(r, "libx264", "Install an ffmpeg build with libx264 (most distribution packages include it).")
+}
+
+func (libx264Encoder) InputArgs(filtered bool) []string { return nil }
+
+func (libx264Encoder) OutputArgs(profile Profile, filters []string) []string {
+	// 8-bit 4:2:0, so 10-bit and 4:4:4 sources become playable
+	args := []string{"-c:v", "libx264", "-preset", profile.Preset, "-crf", strconv.Itoa(cmp.Or(profile.Quality, 22)), "-pix_fmt", "yuv420p"}
+	return appendFilters(args, filters)
+}
+
+// svtav1Encoder encodes AV1 on the CPU
+type svtav1Encoder struct{}
+
+// SVT-AV1 presets (0 slowest ... 13 fastest) matching encoderPresets
+var svtav1Presets = []int{12, 11, 10, 9, 8, 6, 5, 4, 3}
+
+func (svtav1Encoder) Name() string        { return "svt-av1" }
+func (svtav1Encoder) Description() string { return "CPU (libsvtav1)" }
+func (svtav1Encoder) Codec() string       { return "av1" }
+func (svtav1Encoder) Hardware() bool      { return false }
+
+func (svtav1Encoder) Available(r Runner) error {
+	return checkFFmpegEncoder(r, "libsvtav1", "Install an ffmpeg build with SVT-AV1 (ffmpeg 6.0 or newer from most distributions).")
+}
+
+func (svtav1Encoder) InputArgs(filtered bool) []string { return nil }
+
+func (svtav1Encoder) OutputArgs(profile Profile, filters []string) []string {
+	args := []string{"-c:v", "libsvtav1", "-preset", strconv.Itoa(svtav1Presets[profile.presetIndex()]), "-crf", strconv.Itoa(cmp.Or(profile.Quality, 30)), "-pix_fmt", "yuv420p"}
+	return appendFilters(args, filters)
+}
+
+// vp9Encoder encodes VP9 on the CPU
+type vp9Encoder struct{}
+
+// libvpx speeds (0 slowest ... 5 fastest with the good deadline) matching encoderPresets
+var vp9Speeds = []int{5, 5, 5, 4, 3, 2, 1, 1, 0}
+
+func (vp9Encoder) Name() string        { return "libvpx-vp9" }
+func (vp9Encoder) Description() string { return "CPU (libvpx-vp9)" }
+func (vp9Encoder) Codec() string       { return "vp9" }
+func (vp9Encoder) Hardware() bool      { return false }
+
+func (vp9Encoder) Available(r Runner) error {
+	return checkFFmpegEncoder(r, "libvpx-vp9", "Install an ffmpeg build with libvpx (most distribution packages include it).")
+}
+
+func (vp9Encoder) InputArgs(filtered bool) []string { return nil }
+
+func (vp9Encoder) OutputArgs(profile Profile, filters []string) []string {
+	// Constant quality mode needs the bitrate set to 0
+	args := []string{"-c:v", "libvpx-vp9", "-deadline", "good", "-cpu-used", strconv.Itoa(vp9Speeds[profile.presetIndex()]),
+		"-row-mt", "1", "-crf", strconv.Itoa(cmp.Or(profile.Quality, 31)), "-b:v", "0", "-pix_fmt", "yuv420p"}
+	return appendFilters(args, filters)
+}
+
+// nvencEncoder encodes H.264 on NVIDIA GPUs
+type nvencEncoder struct{}
+
+// NVENC presets (p1 fastest ... p7 slowest) matching encoderPresets
+var nvencPresets = []string{"p1", "p1", "p2", "p3", "p4", "p5", "p6", "p7", "p7"}
+
+func (nvencEncoder) Name() string        { return "nvenc" }
+func (nvencEncoder) Description() string { return "NVIDIA NVENC (h264_nvenc)" }
+func (nvencEncoder) Codec() string       { return "h264" }
+func (nvencEncoder) Hardware() bool      { return true }
+
+// Available checks if NVIDIA GPU is available and ffmpeg has NVENC support
+func (nvencEncoder) Available(r Runner) error {
+	// Check if nvidia-smi is available
+	if _, err := r.LookPath("nvidia-smi"); err != nil {
+		return fmt.Errorf("NVIDIA GPU not detected.\n\nRequirements for --gpu:\n  1. NVIDIA driver installed (nvidia-smi must work)\n  2. ffmpeg with NVENC support\n\nDriver installation:\n  Debian/Ubuntu: sudo apt install nvidia-driver-535\n  Fedora/RHEL:   sudo dnf install akmod-nvidia")
+	}
+
+	// Check if GPU is working
+	out, err := output(r, "nvidia-smi", "--query-gpu=name", "--format=csv,noheader")
+	if err != nil {
+		return fmt.Errorf("Error querying NVIDIA GPU: %v\n\nCheck if driver is installed correctly.", err)
+	}
+
+	gpuName := strings.TrimSpace(string(out))
+	if gpuName == "" {
+		return fmt.Errorf("No NVIDIA GPU found.")
+	}
+
+	fmt.Printf("GPU detected: %s\n", gpuName)
+
+	// Check if ffmpeg has NVENC support
+	return checkFFmpegEncoder(r, "h264_nvenc", "ffmpeg needs to be compiled with NVENC support.\n\nInstallation:\n  Debian/Ubuntu: sudo apt install ffmpeg\n  Fedora/RHEL:   sudo dnf install ffmpeg --allowerasing\n\nIf the problem persists, you may need to install ffmpeg\nfrom a repository that includes NVENC support (e.g., RPM Fusion).")
+}
+
+// sessionLimitReached detects the limit of concurrent encodes of consumer
+// GPUs (the driver refuses to open another encoding session)
+func (nvencEncoder) sessionLimitReached(log string) bool {
+	return strings.Contains(log, "OpenEncodeSessionEx failed") &&
+		(strings.Contains(log, "incompatible client key") || strings.Contains(log, "out of memory"))
+}
+
+func (nvencEncoder) InputArgs(filtered bool) []string {
+	// Decode on the GPU as well. Frames stay in GPU memory unless they have
+	// to go through (CPU) filters.
+	if filtered {
+		return []string{"-hwaccel", "cuda"}
+	}
+	return []string{"-hwaccel", "cuda", "-hwaccel_output_format", "cuda"}
+}
+
+func (nvencEncoder) OutputArgs(profile Profile, filters []string) []string {
+	args := []string{"-c:v", "h264_nvenc", "-preset", nvencPresets[profile.presetIndex()], "-cq", strconv.Itoa(cmp.Or(profile.Quality, 23))}
+	return appendFilters(args, filters)
+}
+
+// vaapiEncoder encodes H.264 with VA-API (Intel and AMD GPUs on Linux)
+type vaapiEncoder struct{}
+
+// Render node used for VA-API
+const vaapiDevice = "/dev/dri/renderD128"
+
+func (vaapiEncoder) Name() string        { return "vaapi" }
+func (vaapiEncoder) Description() string { return "VA-API (h264_vaapi)" }
+func (vaapiEncoder) Codec() string       { return "h264" }
+func (vaapiEncoder) Hardware() bool      { return true }
+
+func (vaapiEncoder) Available(r Runner) error {
+	if _, err := os.Stat(vaapiDevice); err != nil {
+		return fmt.Errorf("VA-API device %s not found.\n\nInstall the VA-API driver for your GPU:\n  Debian/Ubuntu: sudo apt install intel-media-va-driver mesa-va-drivers\n  Fedora/RHEL:   sudo dnf install intel-media-driver mesa-va-drivers", vaapiDevice)
+	}
+	return checkFFmpegEncoder(r, "h264_vaapi", "ffmpeg needs to be compiled with VA-API support (most distribution packages include it).")
+}
+
+func (vaapiEncoder) InputArgs(filtered bool) []string {
+	return []string{"-vaapi_device", vaapiDevice}
+}
+
+func (vaapiEncoder) OutputArgs(profile Profile, filters []string) []string {
+	// Frames are uploaded to the GPU after the (CPU) filters
+	filters = append(filters, "format=nv12", "hwupload")
+	args := []string{"-c:v", "h264_vaapi", "-qp", strconv.Itoa(cmp.Or(profile.Quality, 23))}
+	return appendFilters(args, filters)
+}
+
+// qsvEncoder encodes H.264 with Intel Quick Sync Video
+type qsvEncoder struct{}
+
+// Quick Sync presets matching encoderPresets (it has no ultrafast or superfast)
+var qsvPresets = []string{"veryfast", "veryfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow"}
+
+func (qsvEncoder) Name() string        { return "qsv" }
+func (qsvEncoder) Description() string { return "Intel Quick Sync (h264_qsv)" }
+func (qsvEncoder) Codec() string       { return "h264" }
+func (qsvEncoder) Hardware() bool      { return true }
+
+func (qsvEncoder) Available(r Runner) error {
+	return checkFFmpegEncoder(r, "h264_qsv", "ffmpeg needs to be compiled with Quick Sync (libvpl or libmfx) support.")
+}
+
+func (qsvEncoder) InputArgs(filtered bool) []string { return nil }
+
+func (qsvEncoder) OutputArgs(profile Profile, filters []string) []string {
+	args := []string{"-c:v", "h264_qsv", "-preset", qsvPresets[profile.presetIndex()], "-global_quality", strconv.Itoa(cmp.Or(profile.Quality, 23)), "-pix_fmt", "nv12"}
+	return appendFilters(args, filters)
+}
+
+// videotoolboxEncoder encodes H.264 with Apple VideoToolbox (macOS)
+type videotoolboxEncoder struct{}
+
+func (videotoolboxEncoder) Name() string        { return "videotoolbox" }
+func (videotoolboxEncoder) Description() string { return "Apple VideoToolbox (h264_videotoolbox)" }
+func (videotoolboxEncoder) Codec() string       { return "h264" }
+func (videotoolboxEncoder) Hardware() bool      { return true }
+
+func (videotoolboxEncoder) Available(r Runner) error {
+	if runtime.GOOS != "darwin" {
+		return fmt.Errorf("VideoToolbox is only available on macOS.")
+	}
+	return checkFFmpegEncoder(r, "h264_videotoolbox", "Install ffmpeg with Homebrew: brew install ffmpeg")
+}
+
+func (videotoolboxEncoder) InputArgs(filtered bool) []string { return nil }
+
+func (videotoolboxEncoder) OutputArgs(profile Profile, filters []string) []string {
+	// VideoToolbox quality goes from 1 to 100 (higher is better); map the CRF scale onto it
+	quality := min(max(100-2*cmp.Or(profile.Quality, 22), 1), 100)
+	args := []string{"-c:v", "h264_videotoolbox", "-q:v", strconv.Itoa(quality), "-pix_fmt", "yuv420p"}
+	return appendFilters(args, filters)
+}
+
+// appendFilters adds the video filter chain to args, if any
+func appendFilters(args []string, filters []string) []string {
+	if len(filters) == 0 {
+		return args
+	}
+	return append(args, "-vf", strings.Join(filters, ","))
+}
@@ -0,0 +1,166 @@
+package generator
+
+import (
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEncoderArgs(t *testing.T) {
+	profile := DefaultProfile()
+	tuned := DefaultProfile()
+	tuned.Quality = 18
+	tuned.Preset = "veryslow"
+	scale := []string{"scale=-2:'min(720,ih)'"}
+
+	tests := []struct {
+		enc         Encoder
+		input       []string // InputArgs(false)
+		inputFilter []string // InputArgs(true)
+		output      []string // OutputArgs(profile, nil)
+		scaled      []string // OutputArgs(profile, scale)
+		tuned       []string // OutputArgs(tuned, nil)
+	}{
+		{
+			enc:    libx264Encoder{},
+			output: []string{"-c:v", "libx264", "-preset", "fast", "-crf", "22", "-pix_fmt", "yuv420p"},
+			scaled: []string{"-c:v", "libx264", "-preset", "fast", "-crf", "22", "-pix_fmt", "yuv420p", "-vf", "scale=-2:'min(720,ih)'"},
+			tuned:  []string{"-c:v", "libx264", "-preset", "veryslow", "-crf", "18", "-pix_fmt", "yuv420p"},
+		},
+		{
+			enc:    svtav1Encoder{},
+			output: []string{"-c:v", "libsvtav1", "-preset", "8", "-crf", "30", "-pix_fmt", "yuv420p"},
+			scaled: []string{"-c:v", "libsvtav1", "-preset", "8", "-crf", "30", "-pix_fmt", "yuv420p", "-vf", "scale=-2:'min(720,ih)'"},
+			tuned:  []string{"-c:v", "libsvtav1", "-preset", "3", "-crf", "18", "-pix_fmt", "yuv420p"},
+		},
+		{
+			enc:    vp9Encoder{},
+			output: []string{"-c:v", "libvpx-vp9", "-deadline", "good", "-cpu-used", "3", "-row-mt", "1", "-crf", "31", "-b:v", "0", "-pix_fmt", "yuv420p"},
+			scaled: []string{"-c:v", "libvpx-vp9", "-deadline", "good", "-cpu-used", "3", "-row-mt", "1", "-crf", "31", "-b:v", "0", "-pix_fmt", "yuv420p", "-vf", "scale=-2:'min(720,ih)'"},
+			tuned:  []string{"-c:v", "libvpx-vp9", "-deadline", "good", "-cpu-used", "0", "-row-mt", "1", "-crf", "18", "-b:v", "0", "-pix_fmt", "yuv420p"},
+		},
+		{
+			enc:         nvencEncoder{},
+			input:       []string{"-hwaccel", "cuda", "-hwaccel_output_format", "cuda"},
+			inputFilter: []string{"-hwaccel", "cuda"},
+			output:      []string{"-c:v", "h264_nvenc", "-preset", "p4", "-cq", "23"},
+			scaled:      []string{"-c:v", "h264_nvenc", "-preset", "p4", "-cq", "23", "-vf", "scale=-2:'min(720,ih)'"},
+			tuned:       []string{"-c:v", "h264_nvenc", "-preset", "p7", "-cq", "18"},
+		},
+		{
+			enc:         vaapiEncoder{},
+			input:       []string{"-vaapi_device", vaapiDevice},
+			inputFilter: []string{"-vaapi_device", vaapiDevice},
+			output:      []string{"-c:v", "h264_vaapi", "-qp", "23", "-vf", "format=nv12,hwupload"},
+			scaled:      []string{"-c:v", "h264_vaapi", "-qp", "23", "-vf", "scale=-2:'min(720,ih)',format=nv12,hwupload"},
+			tuned:       []string{"-c:v", "h264_vaapi", "-qp", "18", "-vf", "format=nv12,hwupload"},
+		},
+		{
+			enc:    qsvEncoder{},
+			output: []string{"-c:v", "h264_qsv", "-preset", "fast", "-global_quality", "23", "-pix_fmt", "nv12"},
+			scaled: []string{"-c:v", "h264_qsv", "-preset", "fast", "-global_quality", "23", "-pix_fmt", "nv12", "-vf", "scale=-2:'min(720,ih)'"},
+			tuned:  []string{"-c:v", "h264_qsv", "-preset", "veryslow", "-global_quality", "18", "-pix_fmt", "nv12"},
+		},
+		{
+			enc:    videotoolboxEncoder{},
+			output: []string{"-c:v", "h264_videotoolbox", "-q:v", "56", "-pix_fmt", "yuv420p"},
+			scaled: []string{"-c:v", "h264_videotoolbox", "-q:v", "56", "-pix_fmt", "yuv420p", "-vf", "scale=-2:'min(720,ih)'"},
+			tuned:  []string{"-c:v", "h264_videotoolbox", "-q:v", "64", "-pix_fmt", "yuv420p"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.enc.Name(), func(t *testing.T) {
+			if got := tt.enc.InputArgs(false); !slices.Equal(got, tt.input) {
+				t.Errorf("InputArgs(false) = %q, want %q", got, tt.input)
+			}
+			if got := tt.enc.InputArgs(true); !slices.Equal(got, tt.inputFilter) {
+				t.Errorf("InputArgs(true) = %q, want %q", got, tt.inputFilter)
+			}
+			if got := tt.enc.OutputArgs(profile, nil); !slices.Equal(got, tt.output) {
+				t.Errorf("OutputArgs(default) = %q, want %q", got, tt.output)
+			}
+			if got := tt.enc.OutputArgs(profile, slices.Clone(scale)); !slices.Equal(got, tt.scaled) {
+				t.Errorf("OutputArgs(default, scale) = %q, want %q", got, tt.scaled)
+			}
+			if got := tt.enc.OutputArgs(tuned, nil); !slices.Equal(got, tt.tuned) {
+				t.Errorf("OutputArgs(tuned) = %q, want %q", got, tt.tuned)
+			}
+		})
+	}
+}
+
+func TestEncoderAvailable(t *testing.T) {
+	allEncoders := "FAKE_ENCODERS=libx264 libsvtav1 libvpx-vp9 h264_nvenc h264_vaapi h264_qsv h264_videotoolbox"
+
+	type availableTest struct {
+		name    string
+		enc     Encoder
+		env     []string
+		missing []string
+		wantErr string // Substring of the error, empty if available
+	}
+	tests := []availableTest{
+		{"libx264", libx264Encoder{}, []string{"FAKE_ENCODERS=libx264"}, nil, ""},
+		{"libx264 missing", libx264Encoder{}, []string{"FAKE_ENCODERS=libvpx-vp9"}, nil, "does not have libx264 support"},
+		{"svt-av1", svtav1Encoder{}, []string{"FAKE_ENCODERS=libsvtav1"}, nil, ""},
+		{"svt-av1 missing", svtav1Encoder{}, []string{"FAKE_ENCODERS=libx264"}, nil, "does not have libsvtav1 support"},
+		{"libvpx-vp9", vp9Encoder{}, []string{"FAKE_ENCODERS=libvpx-vp9"}, nil, ""},
+		{"libvpx-vp9 missing", vp9Encoder{}, []string{"FAKE_ENCODERS=libx264"}, nil, "does not have libvpx-vp9 support"},
+		{"nvenc", nvencEncoder{}, []string{"FAKE_GPU=NVIDIA GeForce RTX 3060", allEncoders}, nil, ""},
+		{"nvenc without driver", nvencEncoder{}, []string{allEncoders}, []string{"nvidia-smi"}, "NVIDIA GPU not detected"},
+		{"nvenc without GPU", nvencEncoder{}, []string{"FAKE_GPU=", allEncoders}, nil, "No NVIDIA GPU found"},
+		{"nvenc without ffmpeg support", nvencEncoder{}, []string{"FAKE_GPU=NVIDIA GeForce RTX 3060", "FAKE_ENCODERS=libx264"}, nil, "does not have h264_nvenc support"},
+		{"qsv", qsvEncoder{}, []string{"FAKE_ENCODERS=h264_qsv"}, nil, ""},
+		{"qsv missing", qsvEncoder{}, []string{"FAKE_ENCODERS=libx264"}, nil, "does not have h264_qsv support"},
+	}
+
+	// Platform-dependent backends
+	if _, err := os.Stat(vaapiDevice); err != nil {
+		tests = append(tests, availableTest{"vaapi without device", vaapiEncoder{}, []string{allEncoders}, nil, "VA-API device " + vaapiDevice + " not found"})
+	}
+	if runtime.GOOS != "darwin" {
+		tests = append(tests, availableTest{"videotoolbox off macOS", videotoolboxEncoder{}, []string{allEncoders}, nil, "only available on macOS"})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &fakeRunner{env: tt.env, missing: make(map[string]bool)}
+			for _, name := range tt.missing {
+				r.missing[name] = true
+			}
+
+			err := tt.enc.Available(r)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Available() = %v, want nil", err)
+			case tt.wantErr != "" && err == nil:
+				t.Errorf("Available() = nil, want error containing %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Errorf("Available() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSessionLimitReached(t *testing.T) {
+	tests := []struct {
+		enc  Encoder
+		log  string
+		want bool
+	}{
+		{nvencEncoder{}, "[h264_nvenc @ 0x1234] OpenEncodeSessionEx failed: incompatible client key (21): (no details)", true},
+		{nvencEncoder{}, "[h264_nvenc @ 0x1234] OpenEncodeSessionEx failed: out of memory (10): (no details)", true},
+		{nvencEncoder{}, "[h264_nvenc @ 0x1234] OpenEncodeSessionEx failed: unsupported device (2): (no details)", false},
+		{nvencEncoder{}, "Error while opening encoder", false},
+		{libx264Encoder{}, "OpenEncodeSessionEx failed: incompatible client key", false},
+	}
+
+	for _, tt := range tests {
+		if got := sessionLimitReached(tt.enc, tt.log); got != tt.want {
+			t.Errorf("sessionLimitReached(%s, %q) = %v, want %v", tt.enc.Name(), tt.log, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package generator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// outputFormat is a container and codec combination --convert can produce
+type outputFormat struct {
+	name        string          // Name used with --format
+	description string          // e.g. "WebM (VP9/Opus)"
+	extension   string          // Extension of converted files
+	codec       string          // Video codec (see Profile.Codec)
+	audioCodec  string          // ffmpeg audio encoder
+	copyVideo   map[string]bool // Video codecs the container holds as-is
+	copyAudio   map[string]bool // Audio codecs the container holds as-is
+	muxerArgs   []string        // Container options
+}
+
+// Output formats, the default first
+var outputFormats = []outputFormat{
+	{
+		name:        "mp4",
+		description: "MP4 (H.264/AAC)",
+		extension:   ".mp4",
+		codec:       "h264",
+		audioCodec:  "aac",
+		copyVideo:   map[string]bool{"h264": true, "av1": true},
+		copyAudio:   map[string]bool{"aac": true, "mp3": true},
+		muxerArgs:   []string{"-movflags", "+faststart"},
+	},
+	{
+		name:        "av1",
+		description: "MP4 (AV1/AAC)",
+		extension:   ".mp4",
+		codec:       "av1",
+		audioCodec:  "aac",
+		copyVideo:   map[string]bool{"h264": true, "av1": true},
+		copyAudio:   map[string]bool{"aac": true, "mp3": true},
+		muxerArgs:   []string{"-movflags", "+faststart"},
+	},
+	{
+		name:        "webm",
+		description: "WebM (VP9/Opus)",
+		extension:   ".webm",
+		codec:       "vp9",
+		audioCodec:  "libopus",
+		copyVideo:   map[string]bool{"vp8": true, "vp9": true, "av1": true},
+		copyAudio:   map[string]bool{"opus": true},
+	},
+}
+
+// FormatNames returns the names of the output formats
+func FormatNames() []string {
+	names := make([]string, len(outputFormats))
+	for i, format := range outputFormats {
+		names[i] = format.name
+	}
+	return names
+}
+
+// findFormat returns the named output format
+func findFormat(name string) (outputFormat, error) {
+	for _, format := range outputFormats {
+		if format.name == name {
+			return format, nil
+		}
+	}
+	return outputFormat{}, fmt.Errorf("unknown format '%s' (available: %s)", name, strings.Join(FormatNames(), ", "))
+}
+
+// formatForCodec returns the output format producing codec
+func formatForCodec(codec string) outputFormat {
+	for _, format := range outputFormats {
+		if format.codec == codec {
+			return format
+		}
+	}
+	return outputFormats[0]
+}
+
+// convertedSibling returns the converted version of path: the same name
+// with another extension vsite converts to (e.g. movie.mkv -> movie.webm).
+// It returns an empty string if there is none.
+func convertedSibling(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for _, format := range outputFormats {
+		if strings.EqualFold(format.extension, ext) {
+			continue
+		}
+		if _, err := os.Stat(base + format.extension); err == nil {
+			return base + format.extension
+		}
+	}
+	return ""
+}
+
+// isConvertedExtension reports whether vsite converts videos to files with ext
+func isConvertedExtension(ext string) bool {
+	for _, format := range outputFormats {
+		if strings.EqualFold(format.extension, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Video codecs from the most to the least efficient. When a video exists in
+// several encodings, the player lists them in this order.
+var codecPreference = []string{"av1", "vp9", "vp8", "h264"}
+
+// H.264 profiles as reported by ffprobe, with their profile_idc and
+// constraint flags for avc1 codec strings
+var h264ProfileIDs = map[string][2]byte{
+	"Constrained Baseline":  {0x42, 0x40},
+	"Baseline":              {0x42, 0x00},
+	"Main":                  {0x4d, 0x00},
+	"Extended":              {0x58, 0x00},
+	"High":                  {0x64, 0x00},
+	"High 10":               {0x6e, 0x00},
+	"High 4:2:2":            {0x7a, 0x00},
+	"High 4:4:4 Predictive": {0xf4, 0x00},
+}
+
+// AV1 and VP9 profiles as reported by ffprobe, with their number
+var av1Profiles = map[string]int{"Main": 0, "High": 1, "Professional": 2}
+var vp9Profiles = map[string]int{"Profile 0": 0, "Profile 1": 1, "Profile 2": 2, "Profile 3": 3}
+
+// AAC profiles as reported by ffprobe, with their audio object type
+var aacObjectTypes = map[string]int{"LC": 2, "HE-AAC": 5, "HE-AACv2": 29}
+
+// Codec strings of the codecs that have no profile or level in them
+var fixedCodecStrings = map[string]string{
+	"vp8":    "vp8",
+	"mp3":    "mp4a.69",
+	"opus":   "opus",
+	"vorbis": "vorbis",
+	"flac":   "flac",
+}
+
+// bitDepthPattern matches the bit depth at the end of a pixel format (e.g. yuv420p10le)
+var bitDepthPattern = regexp.MustCompile(`(\d+)(?:le|be)$`)
+
+// bitDepth returns the bits per sample of a pixel format, 0 if unknown
+func bitDepth(pixFmt string) int {
+	if pixFmt == "" {
+		return 0
+	}
+	if m := bitDepthPattern.FindStringSubmatch(pixFmt); m != nil {
+		depth, _ := strconv.Atoi(m[1])
+		return depth
+	}
+	return 8
+}
+
+// videoCodecString returns the codec string (RFC 6381) of the video
+// stream (e.g. avc1.640028), empty when its profile, level or bit depth
+// is unknown
+func (v *Video) videoCodecString() string {
+	if fixed, ok := fixedCodecStrings[v.VideoCodec]; ok {
+		return fixed
+	}
+	depth := bitDepth(v.PixFmt)
+	if v.VideoLevel <= 0 || depth == 0 {
+		return ""
+	}
+
+	switch v.VideoCodec {
+	case "h264":
+		if id, ok := h264ProfileIDs[v.VideoProfile]; ok {
+			return fmt.Sprintf("avc1.%02x%02x%02x", id[0], id[1], v.VideoLevel)
+		}
+	case "av1":
+		// ffprobe reports the level index, not the tier, which is Main for
+		// nearly every file
+		if profile, ok := av1Profiles[v.VideoProfile]; ok {
+			return fmt.Sprintf("av01.%d.%02dM.%02d", profile, v.VideoLevel, depth)
+		}
+	case "vp9":
+		if profile, ok := vp9Profiles[v.VideoProfile]; ok {
+			return fmt.Sprintf("vp09.%02d.%02d.%02d", profile, v.VideoLevel, depth)
+		}
+	}
+	return ""
+}
+
+// audioCodecString returns the codec string (RFC 6381) of the audio
+// stream (e.g. mp4a.40.2), empty when its profile is unknown
+func (v *Video) audioCodecString() string {
+	if fixed, ok := fixedCodecStrings[v.AudioCodec]; ok {
+		return fixed
+	}
+	if objectType, ok := aacObjectTypes[v.AudioProfile]; ok && v.AudioCodec == "aac" {
+		return fmt.Sprintf("mp4a.40.%d", objectType)
+	}
+	return ""
+}
+
+// sortedEncodings returns the video and its other encodings, the most
+// efficient codec first
+func (v *Video) sortedEncodings() []*Video {
+	rank := func(video *Video) int {
+		if i := slices.Index(codecPreference, video.VideoCodec); i >= 0 {
+			return i
+		}
+		return len(codecPreference)
+	}
+	encodings := append([]*Video{v}, v.encodings...)
+	slices.SortStableFunc(encodings, func(a, b *Video) int { return rank(a) - rank(b) })
+	return encodings
+}
+
+// sourceType returns the MIME type of the file with its codecs
+// (e.g. video/webm; codecs="vp09.00.40.08, opus"), or only the MIME type
+// when the codecs can't be described exactly
+func (v *Video) sourceType() string {
+	mimeType := MimeType(v.Extension)
+	video := v.videoCodecString()
+	if video == "" {
+		return mimeType
+	}
+	codecs := []string{video}
+	if v.AudioCodec != "" {
+		audio := v.audioCodecString()
+		if audio == "" {
+			return mimeType
+		}
+		codecs = append(codecs, audio)
+	}
+	return fmt.Sprintf(`%s; codecs="%s"`, mimeType, strings.Join(codecs, ", "))
+}
+
+// EncodingsText lists the files the video is available in, most efficient
+// first (e.g. "WEBM (vp9), MP4 (h264)"), empty if there is only one
+func (v *Video) EncodingsText() string {
+	if len(v.encodings) == 0 {
+		return ""
+	}
+	var parts []string
+	for _, encoding := range v.sortedEncodings() {
+		part := strings.ToUpper(strings.TrimPrefix(encoding.Extension, "."))
+		if encoding.VideoCodec != "" {
+			part += " (" + encoding.VideoCodec + ")"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,95 @@
+package generator
+
+import (
+	"testing"
+)
+
+func TestSourceType(t *testing.T) {
+	tests := []struct {
+		name  string
+		video Video
+		want  string
+	}{
+		{
+			name:  "H.264 High 4.0 with AAC LC",
+			video: Video{Extension: ".mp4", Metadata: Metadata{VideoCodec: "h264", VideoProfile: "High", VideoLevel: 40, PixFmt: "yuv420p", AudioCodec: "aac", AudioProfile: "LC"}},
+			want:  `video/mp4; codecs="avc1.640028, mp4a.40.2"`,
+		},
+		{
+			name:  "H.264 Constrained Baseline 3.0 with HE-AAC",
+			video: Video{Extension: ".mp4", Metadata: Metadata{VideoCodec: "h264", VideoProfile: "Constrained Baseline", VideoLevel: 30, PixFmt: "yuv420p", AudioCodec: "aac", AudioProfile: "HE-AAC"}},
+			want:  `video/mp4; codecs="avc1.42401e, mp4a.40.5"`,
+		},
+		{
+			name:  "H.264 Main 3.1 without audio",
+			video: Video{Extension: ".mp4", Metadata: Metadata{VideoCodec: "h264", VideoProfile: "Main", VideoLevel: 31, PixFmt: "yuv420p"}},
+			want:  `video/mp4; codecs="avc1.4d001f"`,
+		},
+		{
+			name:  "10-bit AV1",
+			video: Video{Extension: ".mp4", Metadata: Metadata{VideoCodec: "av1", VideoProfile: "Main", VideoLevel: 8, PixFmt: "yuv420p10le", AudioCodec: "aac", AudioProfile: "LC"}},
+			want:  `video/mp4; codecs="av01.0.08M.10, mp4a.40.2"`,
+		},
+		{
+			name:  "VP9 with Opus",
+			video: Video{Extension: ".webm", Metadata: Metadata{VideoCodec: "vp9", VideoProfile: "Profile 0", VideoLevel: 31, PixFmt: "yuv420p", AudioCodec: "opus"}},
+			want:  `video/webm; codecs="vp09.00.31.08, opus"`,
+		},
+		{
+			name:  "VP8 with Vorbis",
+			video: Video{Extension: ".webm", Metadata: Metadata{VideoCodec: "vp8", AudioCodec: "vorbis"}},
+			want:  `video/webm; codecs="vp8, vorbis"`,
+		},
+		{
+			name:  "unknown level",
+			video: Video{Extension: ".webm", Metadata: Metadata{VideoCodec: "vp9", VideoProfile: "Profile 0", PixFmt: "yuv420p", AudioCodec: "opus"}},
+			want:  "video/webm",
+		},
+		{
+			name:  "unknown profile",
+			video: Video{Extension: ".mp4", Metadata: Metadata{VideoCodec: "h264", VideoLevel: 40, PixFmt: "yuv420p"}},
+			want:  "video/mp4",
+		},
+		{
+			name:  "unknown bit depth",
+			video: Video{Extension: ".mp4", Metadata: Metadata{VideoCodec: "h264", VideoProfile: "High", VideoLevel: 40}},
+			want:  "video/mp4",
+		},
+		{
+			name:  "unknown audio profile",
+			video: Video{Extension: ".mp4", Metadata: Metadata{VideoCodec: "h264", VideoProfile: "High", VideoLevel: 40, PixFmt: "yuv420p", AudioCodec: "aac"}},
+			want:  "video/mp4",
+		},
+		{
+			name:  "not probed",
+			video: Video{Extension: ".mp4"},
+			want:  "video/mp4",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.video.sourceType(); got != tt.want {
+			t.Errorf("%s: sourceType() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBitDepth(t *testing.T) {
+	tests := []struct {
+		pixFmt string
+		want   int
+	}{
+		{"yuv420p", 8},
+		{"nv12", 8},
+		{"yuv420p10le", 10},
+		{"yuv422p12be", 12},
+		{"p010le", 10},
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		if got := bitDepth(tt.pixFmt); got != tt.want {
+			t.Errorf("bitDepth(%q) = %d, want %d", tt.pixFmt, got, tt.want)
+		}
+	}
+}
@@ -7,10 +7,11 @@ import (
 	"html/template"
 	"net/url"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 )
 
 //go:embed templates/index.html
@@ -40,14 +41,76 @@ var needsConversion = map[string]bool{
 	".flv": true,
 }
 
+// MIME types of supported video extensions and generated streaming and
+// track files
+var mimeTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+	".mkv":  "video/x-matroska",
+	".avi":  "video/x-msvideo",
+	".mov":  "video/quicktime",
+	".m4v":  "video/x-m4v",
+	".ogv":  "video/ogg",
+	".3gp":  "video/3gpp",
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+	".vtt":  "text/vtt",
+}
+
+// MimeType returns the MIME type for a video or generated file extension
+// (e.g. ".mp4", ".vtt"), or an empty string if the extension is not known
+func MimeType(ext string) string {
+	return mimeTypes[strings.ToLower(ext)]
+}
+
+// IsInternalFile reports whether name (a slash-separated path relative to
+// the site or media directory) is vsite's own state rather than part of the
+// site: the configuration, and the metadata cache, conversion records and
+// other files directly in .vsite. The generated assets below .vsite are not.
+func IsInternalFile(name string) bool {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	return strings.EqualFold(name, ConfigFileName) || strings.EqualFold(path.Dir(name), path.Dir(cacheFile))
+}
+
 // Video represents a video file found
 type Video struct {
-	Name         string // Filename without extension
-	FileName     string // Full filename
-	RelativePath string // Path relative to root
-	Extension    string // File extension
-	Directory    string // Parent directory (relative to root)
-	PlayerPage   string // Player page filename
+	Name         string     // Filename without extension
+	FileName     string     // Full filename
+	RelativePath string     // Path relative to root
+	Extension    string     // File extension
+	Directory    string     // Parent directory (relative to root)
+	PlayerPage   string     // Player page filename
+	Thumbnail    string     // Thumbnail image path (relative to output), empty if unavailable
+	Preview      string     // Animated preview path (relative to output), empty if not generated
+	HLS          string     // HLS master playlist path (relative to output), empty if not packaged
+	Subtitles    []Subtitle // Subtitle tracks from sidecar files
+	ChapterTrack string     // WebVTT chapters path (relative to output), empty without chapters
+	Sprites      string     // WebVTT seek-bar previews path (relative to output), empty if unavailable
+
+	Size     int64 // File size in bytes
+	Metadata       // Probed metadata (zero values if unavailable)
+
+	modTime    time.Time         // Source file modification time
+	conversion *conversionRecord // How vsite converted the file, nil if it didn't
+	encodings  []*Video          // Same video in other files (e.g. movie.webm next to movie.mp4)
+}
+
+// Metadata contains information probed from the video file
+type Metadata struct {
+	Duration       float64      `json:"duration,omitempty"`        // Duration in seconds
+	Width          int          `json:"width,omitempty"`           // Frame width in pixels
+	Height         int          `json:"height,omitempty"`          // Frame height in pixels
+	VideoCodec     string       `json:"video_codec,omitempty"`     // Video codec name (e.g. h264)
+	VideoProfile   string       `json:"video_profile,omitempty"`   // Video codec profile (e.g. High)
+	VideoLevel     int          `json:"video_level,omitempty"`     // Video codec level as reported by ffprobe (e.g. 40 for H.264 4.0)
+	PixFmt         string       `json:"pix_fmt,omitempty"`         // Pixel format (e.g. yuv420p)
+	AudioCodec     string       `json:"audio_codec,omitempty"`     // Audio codec name (e.g. aac)
+	AudioProfile   string       `json:"audio_profile,omitempty"`   // Audio codec profile (e.g. LC)
+	AudioTracks    []AudioTrack `json:"audio_tracks,omitempty"`    // Audio streams, in file order
+	Bitrate        int64        `json:"bitrate,omitempty"`         // Overall bitrate in bits per second
+	Chapters       []Chapter    `json:"chapters,omitempty"`        // Chapters from container metadata or scene detection
+	ChapterSpacing float64      `json:"chapter_spacing,omitempty"` // Minimum spacing (seconds) of detected chapters, 0 for container chapters
+	CreatedAt      time.Time    `json:"created_at,omitzero"`       // Creation time from container metadata
 }
 
 // Directory represents a directory with videos
@@ -60,19 +123,46 @@ type Directory struct {
 
 // Generator is responsible for generating HTML files
 type Generator struct {
-	rootDir     string
-	outputDir   string
-	customTitle string
-	videos      []*Video
-	dirTree     map[string][]*Video
-	indexTmpl   *template.Template
-	playerTmpl  *template.Template
+	rootDir        string
+	outputDir      string
+	mediaBaseURL   string // Base URL for media links (empty to link relative to the output)
+	mediaPrefix    string // Relative URL path from the output directory to the root
+	customTitle    string
+	videos         []*Video
+	dirTree        map[string][]*Video
+	indexTmpl      *template.Template
+	playerTmpl     *template.Template
+	cache          *metadataCache
+	runner         Runner          // Runs ffmpeg and ffprobe
+	hls            *HLSConfig      // HLS packaging settings, nil when disabled
+	subtitleLang   string          // Language of the subtitles enabled by default
+	audioLang      string          // Language of the audio track selected by default
+	chapterSpacing time.Duration   // Minimum spacing of detected chapters, 0 when detection is disabled
+	previewFormat  string          // Format of animated previews (mp4 or webm), empty when disabled
+	pages          map[string]bool // Pages generated (or kept as they are) during this run
+	affected       *affectedPages  // Pages regenerated after a change (watch mode), nil for all
+	complete       bool            // The last run wrote every page it had to
+	stats          pageStats
+}
+
+// pageStats records what happened to the pages during generation
+type pageStats struct {
+	written   []string // New or modified pages
+	unchanged int      // Pages whose content was already up to date
+	removed   []string // Stale pages deleted
+}
+
+// PageChanges lists the pages affected by the last generation
+type PageChanges struct {
+	Written []string `json:"written"` // New or modified pages
+	Removed []string `json:"removed"` // Deleted pages
 }
 
 // IndexData contains data for the index template
 type IndexData struct {
 	Title       string
 	CurrentPath string
+	Folder      string // CurrentPath with forward slashes, matched against the playback history
 	ParentPath  string
 	HasParent   bool
 	Directories []DirEntry
@@ -87,15 +177,33 @@ type DirEntry struct {
 
 // PlayerData contains data for the player template
 type PlayerData struct {
-	Title     string
-	VideoSrc  string
-	VideoType string
-	BackLink  string
-	VideoName string
-	PrevVideo string
-	NextVideo string
-	HasPrev   bool
-	HasNext   bool
+	Title        string
+	VideoSrc     string
+	VideoType    string
+	BackLink     string
+	VideoName    string
+	PrevVideo    string
+	NextVideo    string
+	HasPrev      bool
+	HasNext      bool
+	Details      []DetailEntry
+	Issues       []string      // Reasons the video probably won't play, if any
+	Sources      []VideoSource // Sources in order of preference (HLS, then the files)
+	Subtitles    []Subtitle
+	AudioLang    string // Preferred audio language, empty for the video's default track
+	AudioLangs   string // Language of each audio track, space-separated (empty with a single track)
+	ChapterTrack string // WebVTT chapters path, empty without chapters
+	Chapters     []Chapter
+	Sprites      string // WebVTT seek-bar previews path, empty if unavailable
+	Page         string // Player page, linked from "Continue watching"
+	Folder       string // Directory of the video with forward slashes (empty at the root)
+	Thumbnail    string
+}
+
+// VideoSource is a <source> of the player
+type VideoSource struct {
+	Src  string
+	Type string
 }
 
 // New creates a new Generator instance
@@ -106,16 +214,45 @@ func New(rootDir string) *Generator {
 		customTitle: "Videos",
 		videos:      make([]*Video, 0),
 		dirTree:     make(map[string][]*Video),
+		runner:      execRunner{},
 	}
 }
 
+// SetRunner replaces how external programs (ffmpeg, ffprobe) are run
+func (g *Generator) SetRunner(r Runner) {
+	g.runner = r
+}
+
 // SetTitle sets the custom title for the root page
 func (g *Generator) SetTitle(title string) {
 	g.customTitle = title
 }
 
+// Changes returns the pages written or removed by the last call to Generate
+func (g *Generator) Changes() PageChanges {
+	return PageChanges{Written: g.stats.written, Removed: g.stats.removed}
+}
+
+// SetOutputDir sets the directory where the site is generated (default: root directory)
+func (g *Generator) SetOutputDir(dir string) {
+	g.outputDir = dir
+}
+
+// SetMediaBaseURL sets the base URL used to link videos instead of a
+// path relative to the output directory
+func (g *Generator) SetMediaBaseURL(baseURL string) {
+	g.mediaBaseURL = strings.TrimSuffix(baseURL, "/")
+}
+
 // Generate executes the complete HTML file generation
 func (g *Generator) Generate() error {
+	return g.generate(nil)
+}
+
+// generate scans the library and writes the site. After changes to the
+// files in changed (watch mode), only the pages they affect are written,
+// unless the previous run didn't complete; nil writes every page.
+func (g *Generator) generate(changed []string) error {
 	// Parse templates
 	var err error
 	g.indexTmpl, err = template.New("index").Parse(indexTemplate)
@@ -128,6 +265,25 @@ func (g *Generator) Generate() error {
 		return fmt.Errorf("error parsing player template: %w", err)
 	}
 
+	// Reset state from a previous run (watch mode)
+	previous, incremental := g.dirTree, changed != nil && g.complete
+	g.complete = false
+	g.videos = make([]*Video, 0)
+	g.dirTree = make(map[string][]*Video)
+	g.pages = make(map[string]bool)
+	g.stats = pageStats{}
+
+	// Prepare output directory
+	if err := os.MkdirAll(g.outputDir, 0755); err != nil {
+		return fmt.Errorf("error creating output directory: %w", err)
+	}
+	if err := g.resolveMediaPrefix(); err != nil {
+		return err
+	}
+
+	// Load metadata from previous runs
+	g.cache = loadCache(filepath.Join(g.outputDir, cacheFile))
+
 	// Scan videos
 	if err := g.scanVideos(); err != nil {
 		return fmt.Errorf("error scanning videos: %w", err)
@@ -138,6 +294,54 @@ func (g *Generator) Generate() error {
 	}
 
 	fmt.Printf("Found %d videos\n", len(g.videos))
+	g.applyConversionRecords()
+
+	// Propose chapters at scene changes (--auto-chapters)
+	g.detectChapters()
+
+	// Generate thumbnails
+	if err := g.generateThumbnails(); err != nil {
+		return fmt.Errorf("error generating thumbnails: %w", err)
+	}
+
+	// Encode animated previews (--previews)
+	if err := g.generatePreviews(); err != nil {
+		return fmt.Errorf("error generating previews: %w", err)
+	}
+
+	// Build seek-bar previews
+	if err := g.generateSprites(); err != nil {
+		return fmt.Errorf("error generating seek previews: %w", err)
+	}
+
+	// Convert subtitles to WebVTT
+	if err := g.generateSubtitles(); err != nil {
+		return fmt.Errorf("error generating subtitles: %w", err)
+	}
+
+	// Write chapter tracks
+	if err := g.generateChapters(); err != nil {
+		return fmt.Errorf("error generating chapters: %w", err)
+	}
+
+	// Package videos for adaptive streaming
+	if g.hls != nil {
+		if err := g.generateHLS(); err != nil {
+			return fmt.Errorf("error generating HLS: %w", err)
+		}
+	}
+
+	// Persist metadata, dropping entries for deleted videos
+	g.cache.prune()
+	if err := g.cache.save(); err != nil {
+		fmt.Printf("Warning: Error saving metadata cache: %v\n", err)
+	}
+
+	// Only the pages affected by the changes, in watch mode
+	g.affected = nil
+	if incremental {
+		g.affected = g.findAffectedPages(changed, previous)
+	}
 
 	// Generate index pages
 	if err := g.generateIndexPages(); err != nil {
@@ -149,19 +353,43 @@ func (g *Generator) Generate() error {
 		return fmt.Errorf("error generating player pages: %w", err)
 	}
 
+	// Remove pages of videos and directories that no longer exist
+	if err := g.removeStalePages(); err != nil {
+		return fmt.Errorf("error removing stale pages: %w", err)
+	}
+
+	g.complete = true
+	fmt.Printf("Pages: %d written, %d unchanged, %d removed\n", len(g.stats.written), g.stats.unchanged, len(g.stats.removed))
 	fmt.Printf("Files generated in: %s\n", g.outputDir)
 	return nil
 }
 
 // scanVideos scans the directory for videos
 func (g *Generator) scanVideos() error {
-	return filepath.Walk(g.rootDir, func(path string, info os.FileInfo, err error) error {
+	// Probing is optional: without ffprobe, videos only have filesystem metadata.
+	// ffprobe is only looked up once a video is missing from the cache.
+	probeChecked, canProbe := false, false
+	probed := 0
+	defer func() {
+		if probed > 0 {
+			fmt.Printf("Probed %d new or changed videos\n", probed)
+		}
+	}()
+
+	excluded := g.excludedDir()
+	var sidecars []sidecarFile
+
+	err := filepath.Walk(g.rootDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// Skip hidden directories
-		if info.IsDir() && strings.HasPrefix(info.Name(), ".") {
+		// Skip hidden directories (but not a root given as ".")
+		if info.IsDir() && path != g.rootDir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() && isDir(path, excluded) {
 			return filepath.SkipDir
 		}
 
@@ -169,18 +397,28 @@ func (g *Generator) scanVideos() error {
 			return nil
 		}
 
+		// Skip hidden files, such as in-progress conversions
+		if strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+
 		ext := strings.ToLower(filepath.Ext(path))
+		if subtitleExtensions[ext] {
+			relPath, err := filepath.Rel(g.rootDir, path)
+			if err != nil {
+				return err
+			}
+			sidecars = append(sidecars, sidecarFile{relPath: relPath, modTime: info.ModTime()})
+			return nil
+		}
 		if !videoExtensions[ext] {
 			return nil
 		}
 
-		// If format needs conversion, check if MP4 exists
-		if needsConversion[ext] {
-			mp4Path := strings.TrimSuffix(path, ext) + ".mp4"
-			if _, err := os.Stat(mp4Path); err == nil {
-				// MP4 version exists, skip this file (MP4 will be processed later)
-				return nil
-			}
+		// If format needs conversion, check if a converted version exists
+		if needsConversion[ext] && convertedSibling(path) != "" {
+			// Converted version exists, skip this file (it is listed instead)
+			return nil
 		}
 
 		relPath, err := filepath.Rel(g.rootDir, path)
@@ -200,6 +438,37 @@ func (g *Generator) scanVideos() error {
 			Extension:    ext,
 			Directory:    dir,
 			PlayerPage:   g.generatePlayerFileName(relPath),
+			Size:         info.Size(),
+			modTime:      info.ModTime(),
+		}
+
+		if entry, ok := g.cache.lookup(relPath, info); ok {
+			video.Metadata = entry.Metadata
+		} else {
+			if !probeChecked {
+				probeChecked = true
+				if _, err := g.runner.LookPath("ffprobe"); err == nil {
+					canProbe = true
+				} else {
+					fmt.Println("ffprobe not found, skipping video metadata")
+				}
+			}
+			if canProbe {
+				probe, err := probeFile(g.runner, path)
+				if err != nil {
+					fmt.Printf("  Warning: Error probing %s: %v\n", info.Name(), err)
+				} else {
+					video.applyProbe(probe)
+					g.cache.store(relPath, info, video.Metadata)
+					probed++
+				}
+			}
+		}
+
+		// Files that won't play because of their codecs are also replaced by
+		// their converted version (e.g. an HEVC .m4v by its MP4)
+		if len(video.codecIssues()) > 0 && convertedSibling(path) != "" {
+			return nil
 		}
 
 		g.videos = append(g.videos, video)
@@ -207,14 +476,65 @@ func (g *Generator) scanVideos() error {
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	g.groupEncodings()
+	g.attachSubtitles(sidecars)
+
+	// Videos are listed, and navigated, by name
+	for _, videos := range g.dirTree {
+		sort.Slice(videos, func(i, j int) bool {
+			return videos[i].Name < videos[j].Name
+		})
+	}
+	return nil
+}
+
+// groupEncodings merges files holding the same video in different
+// encodings (movie.mp4 and movie.webm) into a single video, listed once and
+// played from whichever file the browser supports best. The MP4 is kept as
+// the main file: it provides the page, thumbnail and details.
+func (g *Generator) groupEncodings() {
+	groups := make(map[string][]*Video)
+	var keys []string
+	for _, video := range g.videos {
+		key := filepath.Join(video.Directory, video.Name)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], video)
+	}
+	if len(keys) == len(g.videos) {
+		return
+	}
+
+	g.videos = make([]*Video, 0, len(keys))
+	g.dirTree = make(map[string][]*Video)
+	for _, key := range keys {
+		group := groups[key]
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].Extension == ".mp4" && group[j].Extension != ".mp4"
+		})
+		video := group[0]
+		video.encodings = group[1:]
+		g.videos = append(g.videos, video)
+		g.dirTree[video.Directory] = append(g.dirTree[video.Directory], video)
+	}
 }
 
 // generatePlayerFileName generates the HTML filename for the player
 func (g *Generator) generatePlayerFileName(relPath string) string {
+	return "player_" + fileSlug(relPath) + ".html"
+}
+
+// fileSlug builds a flat, filesystem-safe name from a relative video path
+func fileSlug(relPath string) string {
 	// Replace path separators and special characters
 	name := strings.ReplaceAll(relPath, string(filepath.Separator), "_")
 	name = strings.TrimSuffix(name, filepath.Ext(name))
-	return "player_" + sanitizeFileName(name) + ".html"
+	return sanitizeFileName(name)
 }
 
 // sanitizeFileName removes special characters from filename
@@ -230,6 +550,78 @@ func sanitizeFileName(name string) string {
 	return result.String()
 }
 
+// excludedDir returns the absolute output directory when it is separate
+// from the root (it may live inside it and must not be scanned), or an
+// empty string otherwise
+func (g *Generator) excludedDir() string {
+	outputDir, errOut := filepath.Abs(g.outputDir)
+	rootDir, errRoot := filepath.Abs(g.rootDir)
+	if errOut != nil || errRoot != nil || outputDir == rootDir {
+		return ""
+	}
+	return outputDir
+}
+
+// isDir reports whether path refers to the absolute directory dir
+func isDir(path, dir string) bool {
+	if dir == "" {
+		return false
+	}
+	absPath, err := filepath.Abs(path)
+	return err == nil && absPath == dir
+}
+
+// resolveMediaPrefix computes the relative URL path from the output
+// directory to the root, used to link videos when no base URL is set
+func (g *Generator) resolveMediaPrefix() error {
+	g.mediaPrefix = ""
+	if g.mediaBaseURL != "" {
+		return nil
+	}
+
+	outputDir, err := filepath.Abs(g.outputDir)
+	if err != nil {
+		return err
+	}
+	rootDir, err := filepath.Abs(g.rootDir)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(outputDir, rootDir)
+	if err != nil {
+		return fmt.Errorf("cannot link videos from '%s' to '%s' (use --media-url): %w", g.outputDir, g.rootDir, err)
+	}
+	if rel != "." {
+		g.mediaPrefix = escapePath(rel)
+	}
+	return nil
+}
+
+// mediaURL returns the URL of a file (relative to root) as seen from the output pages
+func (g *Generator) mediaURL(relPath string) string {
+	escaped := escapePath(relPath)
+	switch {
+	case g.mediaBaseURL != "":
+		return g.mediaBaseURL + "/" + escaped
+	case g.mediaPrefix != "":
+		return g.mediaPrefix + "/" + escaped
+	default:
+		return escaped
+	}
+}
+
+// escapePath builds a URL path from a filesystem path or a path already
+// joined with "/" (such as the generated asset paths), URL encoding each
+// path segment individually
+func escapePath(path string) string {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
 // generateIndexPages generates index pages for each directory
 func (g *Generator) generateIndexPages() error {
 	// Collect all unique directories
@@ -248,6 +640,9 @@ func (g *Generator) generateIndexPages() error {
 
 	// Generate index page for each directory
 	for dir := range dirs {
+		if !g.affected.dir(dir) && g.keepPage(indexPageName(dir)) {
+			continue
+		}
 		if err := g.generateIndexPage(dir); err != nil {
 			return err
 		}
@@ -297,11 +692,7 @@ func (g *Generator) generateIndexPage(dir string) error {
 		return directories[i].Name < directories[j].Name
 	})
 
-	// Sort videos in current directory
 	videos := g.dirTree[dir]
-	sort.Slice(videos, func(i, j int) bool {
-		return videos[i].Name < videos[j].Name
-	})
 
 	// Calculate parent directory link
 	var parentPath string
@@ -324,6 +715,7 @@ func (g *Generator) generateIndexPage(dir string) error {
 	data := IndexData{
 		Title:       title,
 		CurrentPath: dir,
+		Folder:      filepath.ToSlash(dir),
 		ParentPath:  parentPath,
 		HasParent:   hasParent,
 		Directories: directories,
@@ -335,19 +727,23 @@ func (g *Generator) generateIndexPage(dir string) error {
 		return err
 	}
 
-	// Determine filename
-	fileName := "index.html"
-	if dir != "" {
-		fileName = strings.ReplaceAll(dir, string(filepath.Separator), "_") + "_index.html"
-	}
+	return g.writePage(indexPageName(dir), buf.Bytes())
+}
 
-	outputPath := filepath.Join(g.outputDir, fileName)
-	return os.WriteFile(outputPath, buf.Bytes(), 0644)
+// indexPageName returns the file name of the index page of dir
+func indexPageName(dir string) string {
+	if dir == "" {
+		return "index.html"
+	}
+	return strings.ReplaceAll(dir, string(filepath.Separator), "_") + "_index.html"
 }
 
 // generatePlayerPages generates player pages for each video
 func (g *Generator) generatePlayerPages() error {
 	for i, video := range g.videos {
+		if !g.affected.video(video.RelativePath) && g.keepPage(video.PlayerPage) {
+			continue
+		}
 		if err := g.generatePlayerPage(video, i); err != nil {
 			return err
 		}
@@ -357,31 +753,10 @@ func (g *Generator) generatePlayerPages() error {
 
 // generatePlayerPage generates the player page for a specific video
 func (g *Generator) generatePlayerPage(video *Video, index int) error {
-	// Build URL-encoded path preserving directory separators
-	// URL encode each path segment individually
-	parts := strings.Split(video.RelativePath, string(filepath.Separator))
-	for i, part := range parts {
-		parts[i] = url.PathEscape(part)
-	}
-	videoSrc := strings.Join(parts, "/")
-
-	// Determine MIME type
-	mimeTypes := map[string]string{
-		".mp4":  "video/mp4",
-		".webm": "video/webm",
-		".mkv":  "video/x-matroska",
-		".avi":  "video/x-msvideo",
-		".mov":  "video/quicktime",
-		".m4v":  "video/x-m4v",
-		".ogv":  "video/ogg",
-		".3gp":  "video/3gpp",
-	}
+	videoSrc := g.mediaURL(video.RelativePath)
 
 	// Back link
-	backLink := "index.html"
-	if video.Directory != "" {
-		backLink = strings.ReplaceAll(video.Directory, string(filepath.Separator), "_") + "_index.html"
-	}
+	backLink := indexPageName(video.Directory)
 
 	// Navigation between videos in the same directory
 	var prevVideo, nextVideo string
@@ -402,16 +777,45 @@ func (g *Generator) generatePlayerPage(video *Video, index int) error {
 		}
 	}
 
+	// With HLS, the player adapts the quality to the connection and only
+	// falls back to the files if the playlist can't be played. Files are
+	// listed with their codecs, so browsers skip those they can't decode.
+	videoType := MimeType(video.Extension)
+	var sources []VideoSource
+	if video.HLS != "" {
+		videoSrc, videoType = escapePath(video.HLS), MimeType(filepath.Ext(hlsMasterPlaylist))
+		sources = append(sources, VideoSource{videoSrc, videoType})
+	}
+	if len(video.encodings) == 0 {
+		sources = append(sources, VideoSource{g.mediaURL(video.RelativePath), MimeType(video.Extension)})
+	} else {
+		for _, encoding := range video.sortedEncodings() {
+			sources = append(sources, VideoSource{g.mediaURL(encoding.RelativePath), encoding.sourceType()})
+		}
+	}
+
 	data := PlayerData{
-		Title:     video.Name,
-		VideoSrc:  videoSrc,
-		VideoType: mimeTypes[video.Extension],
-		BackLink:  backLink,
-		VideoName: video.FileName,
-		PrevVideo: prevVideo,
-		NextVideo: nextVideo,
-		HasPrev:   hasPrev,
-		HasNext:   hasNext,
+		Title:        video.Name,
+		VideoSrc:     videoSrc,
+		VideoType:    videoType,
+		BackLink:     backLink,
+		VideoName:    video.FileName,
+		PrevVideo:    prevVideo,
+		NextVideo:    nextVideo,
+		HasPrev:      hasPrev,
+		HasNext:      hasNext,
+		Details:      video.Details(),
+		Issues:       video.PlaybackIssues(),
+		Sources:      sources,
+		Subtitles:    video.Subtitles,
+		AudioLang:    g.audioLang,
+		AudioLangs:   video.audioLanguages(),
+		ChapterTrack: video.ChapterTrack,
+		Chapters:     video.Chapters,
+		Sprites:      video.Sprites,
+		Page:         video.PlayerPage,
+		Folder:       filepath.ToSlash(video.Directory),
+		Thumbnail:    video.Thumbnail,
 	}
 
 	var buf bytes.Buffer
@@ -419,8 +823,63 @@ func (g *Generator) generatePlayerPage(video *Video, index int) error {
 		return err
 	}
 
-	outputPath := filepath.Join(g.outputDir, video.PlayerPage)
-	return os.WriteFile(outputPath, buf.Bytes(), 0644)
+	return g.writePage(video.PlayerPage, buf.Bytes())
+}
+
+// writePage writes a generated page to the output directory, leaving the
+// file untouched when its content hasn't changed
+func (g *Generator) writePage(fileName string, content []byte) error {
+	g.pages[fileName] = true
+
+	outputPath := filepath.Join(g.outputDir, fileName)
+	if existing, err := os.ReadFile(outputPath); err == nil && bytes.Equal(existing, content) {
+		g.stats.unchanged++
+		return nil
+	}
+
+	if err := os.WriteFile(outputPath, content, 0644); err != nil {
+		return err
+	}
+	g.stats.written = append(g.stats.written, fileName)
+	return nil
+}
+
+// keepPage records a page that is left as it is, if it still exists
+func (g *Generator) keepPage(fileName string) bool {
+	if _, err := os.Stat(filepath.Join(g.outputDir, fileName)); err != nil {
+		return false
+	}
+	g.pages[fileName] = true
+	g.stats.unchanged++
+	return true
+}
+
+// removeStalePages deletes index and player pages that were not generated
+// during this run (i.e., their video or directory no longer exists)
+func (g *Generator) removeStalePages() error {
+	patterns := []string{
+		"*_index.html",
+		"player_*.html",
+	}
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(g.outputDir, pattern))
+		if err != nil {
+			return err
+		}
+		for _, match := range matches {
+			if g.pages[filepath.Base(match)] {
+				continue
+			}
+			if err := os.Remove(match); err != nil {
+				return fmt.Errorf("error removing %s: %w", match, err)
+			}
+			fmt.Printf("Removed stale page: %s\n", filepath.Base(match))
+			g.stats.removed = append(g.stats.removed, filepath.Base(match))
+		}
+	}
+
+	return nil
 }
 
 // generateStylesheet generates the CSS file
@@ -743,7 +1202,7 @@ func (g *Generator) Clean() (int, error) {
 	}
 
 	for _, pattern := range patterns {
-		matches, err := filepath.Glob(filepath.Join(g.rootDir, pattern))
+		matches, err := filepath.Glob(filepath.Join(g.outputDir, pattern))
 		if err != nil {
 			return count, err
 		}
@@ -756,16 +1215,113 @@ func (g *Generator) Clean() (int, error) {
 		}
 	}
 
+	// Metadata cache
+	cachePath := filepath.Join(g.outputDir, cacheFile)
+	if err := os.Remove(cachePath); err == nil {
+		fmt.Printf("Removed: %s\n", cacheFile)
+		count++
+	} else if !os.IsNotExist(err) {
+		return count, fmt.Errorf("error removing %s: %w", cachePath, err)
+	}
+
+	// Generated assets. Previews go first, so the thumbnail directory they
+	// share is empty when the thumbnails are removed.
+	assets := []struct {
+		dir      string
+		patterns []string
+		what     string
+	}{
+		{thumbnailDir, previewPatterns, "previews"},
+		{thumbnailDir, thumbnailPatterns, "thumbnails"},
+		{subtitleDir, subtitlePatterns, "subtitles"},
+		{spriteDir, spritePatterns, "seek preview files"},
+		{chapterDir, chapterPatterns, "chapter files"},
+	}
+	for _, asset := range assets {
+		n, err := removeFiles(filepath.Join(g.outputDir, asset.dir), asset.patterns, asset.what)
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+
+	// HLS renditions
+	n, err := removeHLS(filepath.Join(g.outputDir, hlsDir))
+	count += n
+	if err != nil {
+		return count, err
+	}
+
 	return count, nil
 }
 
-// CleanConverted removes MP4 files that were converted from other formats
-// (i.e., MP4 files that have a corresponding original file like .avi, .mkv, etc)
+// pruneFiles removes the files in dir matching any of patterns whose name
+// is not in keep (all of them when keep is nil) and returns how many were
+// removed
+func pruneFiles(dir string, patterns []string, keep map[string]bool) (int, error) {
+	count := 0
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return count, err
+		}
+		for _, match := range matches {
+			if keep[filepath.Base(match)] {
+				continue
+			}
+			if err := os.Remove(match); err != nil {
+				return count, fmt.Errorf("error removing %s: %w", match, err)
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// removeFiles deletes the files in dir matching any of patterns, reports
+// how many were removed (e.g. "Removed: 3 thumbnails") and removes dir and
+// its parent if they are now empty
+func removeFiles(dir string, patterns []string, what string) (int, error) {
+	count, err := pruneFiles(dir, patterns, nil)
+	if err != nil {
+		return count, err
+	}
+	if count > 0 {
+		fmt.Printf("Removed: %d %s\n", count, what)
+	}
+
+	// Remove the directory tree if it is now empty
+	os.Remove(dir)
+	os.Remove(filepath.Dir(dir))
+
+	return count, nil
+}
+
+// CleanConverted removes MP4 and WebM files that were converted from other formats
+// (i.e., files that have a corresponding original file like .avi, .mkv, etc)
+// and restores MP4 files that were converted in place (movie.mp4.orig).
+// Subtitles extracted during conversion are removed as well, and the
+// conversion records of the removed or restored files are deleted.
 func (g *Generator) CleanConverted() (int, error) {
 	count := 0
 
 	fmt.Println("Searching for converted files...")
 
+	recordsPath := filepath.Join(g.outputDir, conversionsFile)
+	records := loadConversions(recordsPath)
+	recordsChanged := false
+	for _, record := range records {
+		for _, subtitle := range record.Subtitles {
+			path := filepath.Join(g.rootDir, filepath.FromSlash(subtitle))
+			if err := os.Remove(path); err == nil {
+				fmt.Printf("Removed: %s (extracted from %s)\n", filepath.Base(path), filepath.Base(filepath.FromSlash(record.Source)))
+				count++
+			} else if !os.IsNotExist(err) {
+				return count, fmt.Errorf("error removing %s: %w", path, err)
+			}
+		}
+	}
+
 	err := filepath.Walk(g.rootDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -778,9 +1334,21 @@ func (g *Generator) CleanConverted() (int, error) {
 			return nil
 		}
 
-		// Check if it's an MP4 file
+		// Restore MP4 files that were replaced by their converted version
+		if strings.HasSuffix(path, originalSuffix) {
+			convertedPath := strings.TrimSuffix(path, originalSuffix)
+			if err := os.Rename(path, convertedPath); err != nil {
+				return fmt.Errorf("error restoring %s: %w", convertedPath, err)
+			}
+			fmt.Printf("Restored: %s (original of converted file)\n", filepath.Base(convertedPath))
+			count++
+			recordsChanged = g.forgetConversion(records, convertedPath) || recordsChanged
+			return nil
+		}
+
+		// Check if it's a file vsite converts to (MP4, WebM)
 		ext := strings.ToLower(filepath.Ext(path))
-		if ext != ".mp4" {
+		if !isConvertedExtension(ext) {
 			return nil
 		}
 
@@ -791,12 +1359,13 @@ func (g *Generator) CleanConverted() (int, error) {
 		for _, origExt := range originalExtensions {
 			originalPath := basePath + origExt
 			if _, err := os.Stat(originalPath); err == nil {
-				// Original exists, this MP4 was converted - remove it
+				// Original exists, this file was converted - remove it
 				if err := os.Remove(path); err != nil {
 					return fmt.Errorf("error removing %s: %w", path, err)
 				}
 				fmt.Printf("Removed: %s (original: %s)\n", filepath.Base(path), filepath.Base(originalPath))
 				count++
+				recordsChanged = g.forgetConversion(records, path) || recordsChanged
 				break
 			}
 		}
@@ -804,6 +1373,13 @@ func (g *Generator) CleanConverted() (int, error) {
 		return nil
 	})
 
+	// The records describe files that are no longer converted
+	if recordsChanged {
+		if saveErr := saveConversions(recordsPath, records); saveErr != nil && err == nil {
+			err = fmt.Errorf("error saving conversion records: %w", saveErr)
+		}
+	}
+
 	if err != nil {
 		return count, err
 	}
@@ -811,8 +1387,23 @@ func (g *Generator) CleanConverted() (int, error) {
 	return count, nil
 }
 
-// CleanOriginal removes original files (avi, mkv, etc) that have been converted to MP4
-// (i.e., original files that have a corresponding MP4 file)
+// forgetConversion deletes the record of the converted file at path and
+// reports whether there was one
+func (g *Generator) forgetConversion(records map[string]conversionRecord, path string) bool {
+	relPath, err := filepath.Rel(g.rootDir, path)
+	if err != nil {
+		return false
+	}
+	if _, ok := records[cacheKey(relPath)]; !ok {
+		return false
+	}
+	delete(records, cacheKey(relPath))
+	return true
+}
+
+// CleanOriginal removes original files (avi, mkv, etc) that have been converted
+// (i.e., original files that have a corresponding MP4 or WebM file)
+// and the originals kept when an MP4 was converted in place (movie.mp4.orig)
 func (g *Generator) CleanOriginal() (int, error) {
 	count := 0
 
@@ -832,6 +1423,18 @@ func (g *Generator) CleanOriginal() (int, error) {
 			return nil
 		}
 
+		// MP4 files replaced by their converted version
+		if strings.HasSuffix(path, originalSuffix) {
+			if _, err := os.Stat(strings.TrimSuffix(path, originalSuffix)); err == nil {
+				if err := os.Remove(path); err != nil {
+					return fmt.Errorf("error removing %s: %w", path, err)
+				}
+				fmt.Printf("Removed: %s (converted: %s)\n", filepath.Base(path), strings.TrimSuffix(filepath.Base(path), originalSuffix))
+				count++
+			}
+			return nil
+		}
+
 		ext := strings.ToLower(filepath.Ext(path))
 
 		// Check if it's an original format
@@ -847,14 +1450,13 @@ func (g *Generator) CleanOriginal() (int, error) {
 			return nil
 		}
 
-		// Check if there's a corresponding MP4 file
-		mp4Path := strings.TrimSuffix(path, ext) + ".mp4"
-		if _, err := os.Stat(mp4Path); err == nil {
-			// MP4 exists, this original was converted - remove it
+		// Check if there's a corresponding converted file
+		if convertedPath := convertedSibling(path); convertedPath != "" {
+			// Converted file exists, this original was converted - remove it
 			if err := os.Remove(path); err != nil {
 				return fmt.Errorf("error removing %s: %w", path, err)
 			}
-			fmt.Printf("Removed: %s (converted: %s)\n", filepath.Base(path), filepath.Base(mp4Path))
+			fmt.Printf("Removed: %s (converted: %s)\n", filepath.Base(path), filepath.Base(convertedPath))
 			count++
 		}
 
@@ -867,153 +1469,3 @@ func (g *Generator) CleanOriginal() (int, error) {
 
 	return count, nil
 }
-
-// ConvertVideos converts incompatible videos to MP4 using ffmpeg
-func (g *Generator) ConvertVideos(useGPU bool) error {
-	// Check if ffmpeg is installed
-	if _, err := exec.LookPath("ffmpeg"); err != nil {
-		return fmt.Errorf("ffmpeg not found. Install with:\n  Debian/Ubuntu: sudo apt install ffmpeg\n  Fedora/RHEL:   sudo dnf install ffmpeg")
-	}
-
-	// If using GPU, check requirements
-	if useGPU {
-		if err := g.checkNvidiaGPU(); err != nil {
-			return err
-		}
-		fmt.Println("NVIDIA GPU detected, using NVENC for conversion")
-	}
-
-	fmt.Println("Searching for videos to convert...")
-
-	var toConvert []string
-
-	// Scan directory for videos that need conversion
-	err := filepath.Walk(g.rootDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if info.IsDir() {
-			if strings.HasPrefix(info.Name(), ".") {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-
-		ext := strings.ToLower(filepath.Ext(path))
-		if !needsConversion[ext] {
-			return nil
-		}
-
-		// Check if MP4 version already exists
-		mp4Path := strings.TrimSuffix(path, ext) + ".mp4"
-		if _, err := os.Stat(mp4Path); err == nil {
-			// MP4 already exists, skip
-			return nil
-		}
-
-		toConvert = append(toConvert, path)
-		return nil
-	})
-
-	if err != nil {
-		return err
-	}
-
-	if len(toConvert) == 0 {
-		fmt.Println("No videos need conversion.")
-		return nil
-	}
-
-	fmt.Printf("Found %d videos to convert\n", len(toConvert))
-
-	for i, videoPath := range toConvert {
-		ext := filepath.Ext(videoPath)
-		mp4Path := strings.TrimSuffix(videoPath, ext) + ".mp4"
-		fileName := filepath.Base(videoPath)
-
-		fmt.Printf("[%d/%d] Converting: %s\n", i+1, len(toConvert), fileName)
-
-		// Build ffmpeg command
-		var cmd *exec.Cmd
-		if useGPU {
-			// Use NVIDIA NVENC
-			cmd = exec.Command("ffmpeg",
-				"-hwaccel", "cuda",
-				"-hwaccel_output_format", "cuda",
-				"-i", videoPath,
-				"-c:v", "h264_nvenc",
-				"-preset", "p4",
-				"-cq", "23",
-				"-c:a", "aac",
-				"-b:a", "128k",
-				"-movflags", "+faststart",
-				"-y",
-				mp4Path,
-			)
-		} else {
-			// Use CPU (libx264)
-			cmd = exec.Command("ffmpeg",
-				"-i", videoPath,
-				"-c:v", "libx264",
-				"-preset", "fast",
-				"-crf", "22",
-				"-c:a", "aac",
-				"-b:a", "128k",
-				"-movflags", "+faststart",
-				"-y",
-				mp4Path,
-			)
-		}
-
-		// Capture stderr to show progress
-		cmd.Stderr = os.Stderr
-
-		if err := cmd.Run(); err != nil {
-			fmt.Printf("  Warning: Error converting %s: %v\n", fileName, err)
-			// Remove partial file if exists
-			os.Remove(mp4Path)
-			continue
-		}
-
-		fmt.Printf("  Done: %s\n", filepath.Base(mp4Path))
-	}
-
-	fmt.Println("Conversion completed!")
-	return nil
-}
-
-// checkNvidiaGPU checks if NVIDIA GPU is available and ffmpeg has NVENC support
-func (g *Generator) checkNvidiaGPU() error {
-	// Check if nvidia-smi is available
-	if _, err := exec.LookPath("nvidia-smi"); err != nil {
-		return fmt.Errorf("NVIDIA GPU not detected.\n\nRequirements for --gpu:\n  1. NVIDIA driver installed (nvidia-smi must work)\n  2. ffmpeg with NVENC support\n\nDriver installation:\n  Debian/Ubuntu: sudo apt install nvidia-driver-535\n  Fedora/RHEL:   sudo dnf install akmod-nvidia")
-	}
-
-	// Check if GPU is working
-	cmd := exec.Command("nvidia-smi", "--query-gpu=name", "--format=csv,noheader")
-	output, err := cmd.Output()
-	if err != nil {
-		return fmt.Errorf("Error querying NVIDIA GPU: %v\n\nCheck if driver is installed correctly.", err)
-	}
-
-	gpuName := strings.TrimSpace(string(output))
-	if gpuName == "" {
-		return fmt.Errorf("No NVIDIA GPU found.")
-	}
-
-	fmt.Printf("GPU detected: %s\n", gpuName)
-
-	// Check if ffmpeg has NVENC support
-	cmd = exec.Command("ffmpeg", "-hide_banner", "-encoders")
-	output, err = cmd.Output()
-	if err != nil {
-		return fmt.Errorf("Error checking ffmpeg encoders: %v", err)
-	}
-
-	if !strings.Contains(string(output), "h264_nvenc") {
-		return fmt.Errorf("ffmpeg does not have NVENC support.\n\nffmpeg needs to be compiled with NVENC support.\n\nInstallation:\n  Debian/Ubuntu: sudo apt install ffmpeg\n  Fedora/RHEL:   sudo dnf install ffmpeg --allowerasing\n\nIf the problem persists, you may need to install ffmpeg\nfrom a repository that includes NVENC support (e.g., RPM Fusion).")
-	}
-
-	return nil
-}
@@ -0,0 +1,77 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPruneFiles(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, ".vsite", "chapters")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"kept.vtt", "kept.jpg", "stale.vtt", "stale.jpg", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// listDir returns the names of the files left in dir
+	listDir := func() []string {
+		entries, _ := os.ReadDir(dir)
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		return names
+	}
+
+	n, err := pruneFiles(dir, chapterPatterns, map[string]bool{"kept.vtt": true, "kept.jpg": true})
+	if err != nil || n != 2 {
+		t.Fatalf("pruneFiles() = %d, %v; want 2 removed", n, err)
+	}
+	if got, want := listDir(), []string{"kept.jpg", "kept.vtt", "notes.txt"}; !slices.Equal(got, want) {
+		t.Errorf("after pruning: %q, want %q", got, want)
+	}
+
+	// Files not matching the patterns stay, and so does the directory
+	n, err = removeFiles(dir, chapterPatterns, "chapter files")
+	if err != nil || n != 2 {
+		t.Fatalf("removeFiles() = %d, %v; want 2 removed", n, err)
+	}
+	if got, want := listDir(), []string{"notes.txt"}; !slices.Equal(got, want) {
+		t.Errorf("after removing: %q, want %q", got, want)
+	}
+
+	// Once empty, the directory and its parent are removed
+	if err := os.Remove(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := removeFiles(dir, chapterPatterns, "chapter files"); err != nil {
+		t.Fatalf("removeFiles() = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".vsite")); !os.IsNotExist(err) {
+		t.Errorf("empty .vsite directory left behind: %v", err)
+	}
+}
+
+func TestEscapePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"movie.mp4", "movie.mp4"},
+		{filepath.Join("Season 1", "Épisode #1.mp4"), "Season%201/%C3%89pisode%20%231.mp4"},
+		{hlsDir + "/season_1_movie/" + hlsMasterPlaylist, ".vsite/hls/season_1_movie/master.m3u8"},
+		{"a?b/c%d.mp4", "a%3Fb/c%25d.mp4"},
+	}
+
+	for _, tt := range tests {
+		if got := escapePath(tt.path); got != tt.want {
+			t.Errorf("escapePath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package generator
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Directory (relative to output) where HLS renditions are stored, one
+// subdirectory per video
+const hlsDir = ".vsite/hls"
+
+// Master playlist of each video, the one the player loads
+const hlsMasterPlaylist = "master.m3u8"
+
+// First line after #EXTM3U in master playlists generated by vsite. It
+// records the settings, so playlists are regenerated when they change.
+const hlsSettingsPrefix = "## vsite: "
+
+// Video bitrates in kilobits or megabits per second, such as 2800k or 5M
+var videoBitratePattern = regexp.MustCompile(`^[1-9][0-9]*[kM]$`)
+
+// HLSConfig configures the HLS packaging (the "hls" section of vsite.json)
+type HLSConfig struct {
+	Ladder         []HLSRendition `json:"ladder,omitempty"`          // Renditions, highest first
+	SegmentSeconds int            `json:"segment_seconds,omitempty"` // Segment duration (default: 6)
+	Preset         string         `json:"preset,omitempty"`          // x264 preset (default: fast)
+}
+
+// HLSRendition is a rung of the bitrate ladder
+type HLSRendition struct {
+	Height       int    `json:"height"`                  // Frame height (e.g. 720)
+	VideoBitrate string `json:"video_bitrate"`           // e.g. 2800k or 5M
+	AudioBitrate string `json:"audio_bitrate,omitempty"` // e.g. 128k (default: 128k)
+}
+
+// DefaultHLSConfig returns the built-in ladder: 1080p, 720p and 480p
+func DefaultHLSConfig() HLSConfig {
+	return HLSConfig{
+		Ladder: []HLSRendition{
+			{Height: 1080, VideoBitrate: "5000k", AudioBitrate: "128k"},
+			{Height: 720, VideoBitrate: "2800k", AudioBitrate: "128k"},
+			{Height: 480, VideoBitrate: "1400k", AudioBitrate: "96k"},
+		},
+		SegmentSeconds: 6,
+		Preset:         "fast",
+	}
+}
+
+// withDefaults fills unset values from the built-in configuration
+func (c HLSConfig) withDefaults() HLSConfig {
+	defaults := DefaultHLSConfig()
+	if len(c.Ladder) == 0 {
+		c.Ladder = defaults.Ladder
+	}
+	if c.SegmentSeconds <= 0 {
+		c.SegmentSeconds = defaults.SegmentSeconds
+	}
+	if c.Preset == "" {
+		c.Preset = defaults.Preset
+	}
+
+	// Highest rendition first, each with an audio bitrate
+	c.Ladder = slices.Clone(c.Ladder)
+	slices.SortFunc(c.Ladder, func(a, b HLSRendition) int { return b.Height - a.Height })
+	for i := range c.Ladder {
+		if c.Ladder[i].AudioBitrate == "" {
+			c.Ladder[i].AudioBitrate = "128k"
+		}
+	}
+	return c
+}
+
+// validate checks the values set in the configuration
+func (c HLSConfig) validate() error {
+	heights := make(map[int]bool)
+	for _, rendition := range c.Ladder {
+		if rendition.Height <= 0 {
+			return fmt.Errorf("ladder height must be positive")
+		}
+		if heights[rendition.Height] {
+			return fmt.Errorf("duplicate ladder height %dp", rendition.Height)
+		}
+		heights[rendition.Height] = true
+		if !videoBitratePattern.MatchString(rendition.VideoBitrate) {
+			return fmt.Errorf("invalid video bitrate '%s' for %dp (e.g. 2800k or 5M)", rendition.VideoBitrate, rendition.Height)
+		}
+		if rendition.AudioBitrate != "" && !audioBitratePattern.MatchString(rendition.AudioBitrate) {
+			return fmt.Errorf("invalid audio bitrate '%s' for %dp (e.g. 128k)", rendition.AudioBitrate, rendition.Height)
+		}
+	}
+	if c.Preset != "" && !slices.Contains(encoderPresets, c.Preset) {
+		return fmt.Errorf("unknown preset '%s' (use one of: %s)", c.Preset, strings.Join(encoderPresets, ", "))
+	}
+	return nil
+}
+
+// Summary describes the ladder in one line (e.g. "1080p 5000k, 720p 2800k")
+func (c HLSConfig) Summary() string {
+	parts := make([]string, len(c.Ladder))
+	for i, rendition := range c.Ladder {
+		parts[i] = fmt.Sprintf("%dp %s", rendition.Height, rendition.VideoBitrate)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// kbps returns the video bitrate in kilobits per second
+func (r HLSRendition) kbps() int {
+	if megabits, ok := strings.CutSuffix(r.VideoBitrate, "M"); ok {
+		bitrate, _ := strconv.Atoi(megabits)
+		return bitrate * 1000
+	}
+	bitrate, _ := strconv.Atoi(strings.TrimSuffix(r.VideoBitrate, "k"))
+	return bitrate
+}
+
+// SetHLS enables packaging every video as HLS with the given configuration
+func (g *Generator) SetHLS(config HLSConfig) {
+	config = config.withDefaults()
+	g.hls = &config
+}
+
+// generateHLS packages each video as HLS with a rendition per rung of the
+// ladder. Existing renditions are reused unless the video is newer or the
+// settings changed. Videos without packaging play the original file.
+func (g *Generator) generateHLS() error {
+	if _, err := g.runner.LookPath("ffmpeg"); err != nil {
+		fmt.Println("ffmpeg not found, skipping HLS packaging")
+		return nil
+	}
+
+	dir := filepath.Join(g.outputDir, hlsDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// Find the videos to package first, to show the batch progress
+	var pending []*Video
+	var durations []float64
+	keep := make(map[string]bool)
+	for _, video := range g.videos {
+		slug := fileSlug(video.RelativePath)
+		keep[slug] = true
+
+		// Without metadata, the audio and the height of the video are unknown
+		if video.VideoCodec == "" {
+			fmt.Printf("  Warning: Skipping HLS packaging of %s: video not probed\n", video.FileName)
+			continue
+		}
+
+		if hlsUpToDate(filepath.Join(dir, slug), video, g.hlsSettings(video)) {
+			video.HLS = hlsDir + "/" + slug + "/" + hlsMasterPlaylist
+			continue
+		}
+		pending = append(pending, video)
+		durations = append(durations, video.Duration)
+	}
+
+	if len(pending) > 0 {
+		fmt.Printf("Packaging %d videos as HLS (%s)\n", len(pending), g.hls.Summary())
+		display := newProgressDisplay("Packaging", durations)
+		failed := 0
+
+		for i, video := range pending {
+			slug := fileSlug(video.RelativePath)
+			job := display.start(i, video.FileName, durations[i])
+			err := g.packageHLS(video, filepath.Join(dir, slug), func(outTime, speed float64) {
+				display.update(job, outTime, speed)
+			})
+			if err != nil {
+				display.finish(job, fmt.Sprintf("%s Failed: %s", job.prefix, video.FileName), lastLines(err.Error(), failureLogLines))
+				failed++
+				continue
+			}
+			display.finish(job, fmt.Sprintf("%s Packaged: %s", job.prefix, video.FileName), nil)
+			video.HLS = hlsDir + "/" + slug + "/" + hlsMasterPlaylist
+		}
+
+		fmt.Printf("Packaged %d videos as HLS, %d failed\n", len(pending)-failed, failed)
+	}
+
+	return pruneHLS(dir, keep)
+}
+
+// hlsRenditions returns the renditions for a video: the rungs of the ladder
+// not above its height (never upscaling), or the lowest one for small videos
+// and those of unknown height
+func (g *Generator) hlsRenditions(video *Video) []HLSRendition {
+	var renditions []HLSRendition
+	for _, rendition := range g.hls.Ladder {
+		if rendition.Height <= video.Height {
+			renditions = append(renditions, rendition)
+		}
+	}
+	if len(renditions) == 0 {
+		renditions = g.hls.Ladder[len(g.hls.Ladder)-1:]
+	}
+	return renditions
+}
+
+// hlsSettings describes everything the packaging of a video depends on
+func (g *Generator) hlsSettings(video *Video) string {
+	parts := []string{fmt.Sprintf("segment=%d", g.hls.SegmentSeconds), "preset=" + g.hls.Preset}
+	for _, rendition := range g.hlsRenditions(video) {
+		parts = append(parts, fmt.Sprintf("%dp:%s/%s", rendition.Height, rendition.VideoBitrate, rendition.AudioBitrate))
+	}
+	return strings.Join(parts, " ")
+}
+
+// hlsUpToDate reports whether the master playlist in dir exists, is not
+// older than the video and was generated with the same settings
+func hlsUpToDate(dir string, video *Video, settings string) bool {
+	f, err := os.Open(filepath.Join(dir, hlsMasterPlaylist))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.ModTime().Before(video.modTime) {
+		return false
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), hlsSettingsPrefix); ok {
+			return value == settings
+		}
+	}
+	return false
+}
+
+// packageHLS encodes all renditions of a video in a single ffmpeg run into
+// dir. It works in a temporary directory, so a failed or interrupted run
+// leaves the previous renditions in place.
+func (g *Generator) packageHLS(video *Video, dir string, onProgress func(outTime, speed float64)) error {
+	tmpDir := dir + ".tmp"
+	os.RemoveAll(tmpDir)
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return err
+	}
+
+	srcPath := filepath.Join(g.rootDir, video.RelativePath)
+	renditions := g.hlsRenditions(video)
+	args := append([]string{"-progress", "pipe:1", "-nostats"}, hlsArgs(srcPath, tmpDir, renditions, *g.hls, video.AudioCodec != "")...)
+
+	cmd := g.runner.Command(context.Background(), "ffmpeg", args...)
+	var output strings.Builder
+	cmd.Stderr = &output
+	progress, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	readProgress(progress, onProgress)
+	if err := cmd.Wait(); err != nil {
+		os.RemoveAll(tmpDir)
+		return fmt.Errorf("%v\n%s", err, output.String())
+	}
+
+	if err := writeHLSSettings(filepath.Join(tmpDir, hlsMasterPlaylist), g.hlsSettings(video)); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+
+	os.RemoveAll(dir)
+	return os.Rename(tmpDir, dir)
+}
+
+// hlsArgs builds the ffmpeg arguments producing one HLS rendition per
+// rung (named after its height) and the master playlist in dir.
+// Keyframes are forced at segment boundaries so players can switch
+// renditions between any two segments.
+func hlsArgs(src, dir string, renditions []HLSRendition, config HLSConfig, hasAudio bool) []string {
+	args := []string{"-hide_banner", "-i", src}
+
+	// Split the video and scale each copy
+	var graph []string
+	split := fmt.Sprintf("[0:v:0]split=%d", len(renditions))
+	for i, rendition := range renditions {
+		split += fmt.Sprintf("[v%d]", i)
+		graph = append(graph, fmt.Sprintf("[v%d]scale=-2:%d[v%dout]", i, rendition.Height, i))
+	}
+	args = append(args, "-filter_complex", strings.Join(append([]string{split}, graph...), ";"))
+
+	var streamMap []string
+	for i, rendition := range renditions {
+		bitrate := rendition.kbps()
+		args = append(args,
+			"-map", fmt.Sprintf("[v%dout]", i),
+			fmt.Sprintf("-b:v:%d", i), rendition.VideoBitrate,
+			fmt.Sprintf("-maxrate:v:%d", i), fmt.Sprintf("%dk", bitrate*107/100),
+			fmt.Sprintf("-bufsize:v:%d", i), fmt.Sprintf("%dk", bitrate*3/2),
+		)
+		entry := fmt.Sprintf("v:%d", i)
+		if hasAudio {
+			args = append(args, "-map", "0:a:0", fmt.Sprintf("-b:a:%d", i), rendition.AudioBitrate)
+			entry += fmt.Sprintf(",a:%d", i)
+		}
+		streamMap = append(streamMap, fmt.Sprintf("%s,name:%dp", entry, rendition.Height))
+	}
+
+	args = append(args,
+		"-c:v", "libx264",
+		"-preset", config.Preset,
+		"-pix_fmt", "yuv420p",
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", config.SegmentSeconds),
+		"-sc_threshold", "0",
+	)
+	if hasAudio {
+		args = append(args, "-c:a", "aac", "-ac", "2")
+	}
+
+	return append(args,
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(config.SegmentSeconds),
+		"-hls_playlist_type", "vod",
+		"-hls_flags", "independent_segments",
+		"-hls_segment_filename", filepath.Join(dir, "%v", "segment_%04d.ts"),
+		"-master_pl_name", hlsMasterPlaylist,
+		"-var_stream_map", strings.Join(streamMap, " "),
+		"-y",
+		filepath.Join(dir, "%v", "index.m3u8"),
+	)
+}
+
+// writeHLSSettings records the settings in the master playlist (after #EXTM3U)
+func writeHLSSettings(path, settings string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	header, rest, _ := strings.Cut(string(data), "\n")
+	return os.WriteFile(path, []byte(header+"\n"+hlsSettingsPrefix+settings+"\n"+rest), 0644)
+}
+
+// pruneHLS removes renditions of videos that no longer exist
+func pruneHLS(dir string, keep map[string]bool) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && !keep[entry.Name()] {
+			if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+				return fmt.Errorf("error removing %s: %w", entry.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// removeHLS deletes generated HLS renditions and returns how many videos had them
+func removeHLS(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	count := 0
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return count, fmt.Errorf("error removing %s: %w", entry.Name(), err)
+		}
+		count++
+	}
+	if count > 0 {
+		fmt.Printf("Removed: HLS renditions of %d videos\n", count)
+	}
+
+	// Remove the directory tree if it is now empty
+	os.Remove(dir)
+	os.Remove(filepath.Dir(dir))
+
+	return count, nil
+}
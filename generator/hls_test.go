@@ -0,0 +1,153 @@
+package generator
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHLSConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  HLSConfig
+		wantErr string // Substring of the error, empty if valid
+	}{
+		{"default", DefaultHLSConfig(), ""},
+		{"empty", HLSConfig{}, ""},
+		{"megabits", HLSConfig{Ladder: []HLSRendition{{Height: 1080, VideoBitrate: "5M"}}}, ""},
+		{"no audio bitrate", HLSConfig{Ladder: []HLSRendition{{Height: 720, VideoBitrate: "2800k"}}}, ""},
+		{"zero height", HLSConfig{Ladder: []HLSRendition{{Height: 0, VideoBitrate: "2800k"}}}, "height must be positive"},
+		{"duplicate height", HLSConfig{Ladder: []HLSRendition{{Height: 720, VideoBitrate: "2800k"}, {Height: 720, VideoBitrate: "1400k"}}}, "duplicate ladder height 720p"},
+		{"missing video bitrate", HLSConfig{Ladder: []HLSRendition{{Height: 720}}}, "invalid video bitrate '' for 720p"},
+		{"video bitrate without unit", HLSConfig{Ladder: []HLSRendition{{Height: 720, VideoBitrate: "2800"}}}, "invalid video bitrate '2800'"},
+		{"video bitrate in bits", HLSConfig{Ladder: []HLSRendition{{Height: 720, VideoBitrate: "2800000"}}}, "invalid video bitrate"},
+		{"megabit audio bitrate", HLSConfig{Ladder: []HLSRendition{{Height: 720, VideoBitrate: "2800k", AudioBitrate: "1M"}}}, "invalid audio bitrate '1M' for 720p"},
+		{"unknown preset", HLSConfig{Preset: "turbo"}, "unknown preset 'turbo'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("validate() = %v, want nil", err)
+			case tt.wantErr != "" && err == nil:
+				t.Errorf("validate() = nil, want error containing %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Errorf("validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHLSConfigWithDefaults(t *testing.T) {
+	config := HLSConfig{Ladder: []HLSRendition{
+		{Height: 360, VideoBitrate: "800k"},
+		{Height: 1080, VideoBitrate: "6M", AudioBitrate: "160k"},
+	}}.withDefaults()
+
+	want := []HLSRendition{
+		{Height: 1080, VideoBitrate: "6M", AudioBitrate: "160k"},
+		{Height: 360, VideoBitrate: "800k", AudioBitrate: "128k"},
+	}
+	if !slices.Equal(config.Ladder, want) {
+		t.Errorf("Ladder = %v, want %v", config.Ladder, want)
+	}
+	if config.SegmentSeconds != 6 || config.Preset != "fast" {
+		t.Errorf("SegmentSeconds, Preset = %d, %q; want 6, fast", config.SegmentSeconds, config.Preset)
+	}
+}
+
+func TestHLSArgs(t *testing.T) {
+	config := DefaultHLSConfig()
+	renditions := []HLSRendition{
+		{Height: 720, VideoBitrate: "2800k", AudioBitrate: "128k"},
+		{Height: 480, VideoBitrate: "1M", AudioBitrate: "96k"},
+	}
+
+	// value returns the argument following flag
+	value := func(t *testing.T, args []string, flag string) string {
+		t.Helper()
+		i := slices.Index(args, flag)
+		if i < 0 || i+1 >= len(args) {
+			t.Fatalf("%s missing from %q", flag, args)
+		}
+		return args[i+1]
+	}
+
+	t.Run("with audio", func(t *testing.T) {
+		args := hlsArgs("in.mkv", "out", renditions, config, true)
+
+		if got, want := value(t, args, "-var_stream_map"), "v:0,a:0,name:720p v:1,a:1,name:480p"; got != want {
+			t.Errorf("-var_stream_map = %q, want %q", got, want)
+		}
+		if got, want := value(t, args, "-filter_complex"), "[0:v:0]split=2[v0][v1];[v0]scale=-2:720[v0out];[v1]scale=-2:480[v1out]"; got != want {
+			t.Errorf("-filter_complex = %q, want %q", got, want)
+		}
+		for flag, want := range map[string]string{
+			"-b:v:0": "2800k", "-maxrate:v:0": "2996k", "-bufsize:v:0": "4200k", "-b:a:0": "128k",
+			"-b:v:1": "1M", "-maxrate:v:1": "1070k", "-bufsize:v:1": "1500k", "-b:a:1": "96k",
+			"-c:a": "aac", "-hls_time": "6", "-force_key_frames": "expr:gte(t,n_forced*6)",
+		} {
+			if got := value(t, args, flag); got != want {
+				t.Errorf("%s = %q, want %q", flag, got, want)
+			}
+		}
+		if got := args[len(args)-1]; got != filepath.Join("out", "%v", "index.m3u8") {
+			t.Errorf("output = %q, want the variant playlists in out", got)
+		}
+	})
+
+	t.Run("without audio", func(t *testing.T) {
+		args := hlsArgs("in.mkv", "out", renditions, config, false)
+
+		if got, want := value(t, args, "-var_stream_map"), "v:0,name:720p v:1,name:480p"; got != want {
+			t.Errorf("-var_stream_map = %q, want %q", got, want)
+		}
+		if slices.Contains(args, "0:a:0") || slices.Contains(args, "-c:a") {
+			t.Errorf("audio mapped without an audio stream: %q", args)
+		}
+	})
+}
+
+func TestHLSRenditions(t *testing.T) {
+	g := New(t.TempDir())
+	g.SetHLS(DefaultHLSConfig())
+
+	tests := []struct {
+		height int
+		want   []int
+	}{
+		{2160, []int{1080, 720, 480}},
+		{1080, []int{1080, 720, 480}},
+		{720, []int{720, 480}},
+		{360, []int{480}},
+		{0, []int{480}}, // Unknown: never upscale
+	}
+
+	for _, tt := range tests {
+		var heights []int
+		for _, rendition := range g.hlsRenditions(&Video{Metadata: Metadata{Height: tt.height}}) {
+			heights = append(heights, rendition.Height)
+		}
+		if !slices.Equal(heights, tt.want) {
+			t.Errorf("renditions of a %dp video = %v, want %v", tt.height, heights, tt.want)
+		}
+	}
+}
+
+func TestGenerateHLSSkipsUnprobed(t *testing.T) {
+	g := New(t.TempDir())
+	g.SetHLS(DefaultHLSConfig())
+	r := &fakeRunner{}
+	g.SetRunner(r)
+	g.videos = []*Video{{RelativePath: "movie.mp4", FileName: "movie.mp4"}}
+
+	if err := g.generateHLS(); err != nil {
+		t.Fatalf("generateHLS() = %v", err)
+	}
+	if len(r.calls) != 0 || g.videos[0].HLS != "" {
+		t.Errorf("unprobed video packaged: calls %q, HLS %q", r.calls, g.videos[0].HLS)
+	}
+}
@@ -0,0 +1,129 @@
+package generator
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// language is a language subtitles and audio tracks are labeled with
+type language struct {
+	code  string   // ISO 639-1 code, used in language tags
+	codes []string // ISO 639-2 codes (bibliographic and terminology), as used by Matroska
+	name  string   // English name shown in the player
+}
+
+// Languages recognized in file names and stream tags
+var languages = []language{
+	{"ar", []string{"ara"}, "Arabic"},
+	{"bg", []string{"bul"}, "Bulgarian"},
+	{"ca", []string{"cat"}, "Catalan"},
+	{"cs", []string{"cze", "ces"}, "Czech"},
+	{"da", []string{"dan"}, "Danish"},
+	{"de", []string{"ger", "deu"}, "German"},
+	{"el", []string{"gre", "ell"}, "Greek"},
+	{"en", []string{"eng"}, "English"},
+	{"es", []string{"spa"}, "Spanish"},
+	{"et", []string{"est"}, "Estonian"},
+	{"fa", []string{"per", "fas"}, "Persian"},
+	{"fi", []string{"fin"}, "Finnish"},
+	{"fr", []string{"fre", "fra"}, "French"},
+	{"he", []string{"heb"}, "Hebrew"},
+	{"hi", []string{"hin"}, "Hindi"},
+	{"hr", []string{"hrv"}, "Croatian"},
+	{"hu", []string{"hun"}, "Hungarian"},
+	{"id", []string{"ind"}, "Indonesian"},
+	{"is", []string{"ice", "isl"}, "Icelandic"},
+	{"it", []string{"ita"}, "Italian"},
+	{"ja", []string{"jpn"}, "Japanese"},
+	{"ko", []string{"kor"}, "Korean"},
+	{"lt", []string{"lit"}, "Lithuanian"},
+	{"lv", []string{"lav"}, "Latvian"},
+	{"ms", []string{"may", "msa"}, "Malay"},
+	{"nl", []string{"dut", "nld"}, "Dutch"},
+	{"no", []string{"nor", "nob", "nno"}, "Norwegian"},
+	{"pl", []string{"pol"}, "Polish"},
+	{"pt", []string{"por"}, "Portuguese"},
+	{"ro", []string{"rum", "ron"}, "Romanian"},
+	{"ru", []string{"rus"}, "Russian"},
+	{"sk", []string{"slo", "slk"}, "Slovak"},
+	{"sl", []string{"slv"}, "Slovenian"},
+	{"sr", []string{"srp"}, "Serbian"},
+	{"sv", []string{"swe"}, "Swedish"},
+	{"th", []string{"tha"}, "Thai"},
+	{"tr", []string{"tur"}, "Turkish"},
+	{"uk", []string{"ukr"}, "Ukrainian"},
+	{"vi", []string{"vie"}, "Vietnamese"},
+	{"zh", []string{"chi", "zho"}, "Chinese"},
+}
+
+// Regions shown in labels (e.g. "Portuguese (Brazil)"); others show their code
+var regionNames = map[string]string{
+	"BR":  "Brazil",
+	"PT":  "Portugal",
+	"US":  "US",
+	"GB":  "UK",
+	"CA":  "Canada",
+	"AU":  "Australia",
+	"ES":  "Spain",
+	"MX":  "Mexico",
+	"419": "Latin America",
+	"FR":  "France",
+	"BE":  "Belgium",
+	"CH":  "Switzerland",
+	"AT":  "Austria",
+	"CN":  "China",
+	"TW":  "Taiwan",
+	"HK":  "Hong Kong",
+}
+
+// Language tags: a 2 or 3 letter language with an optional region
+// (pt-BR, es-419) or script (zh-Hant)
+var languageTagPattern = regexp.MustCompile(`^([A-Za-z]{2,3})(?:[-_]([A-Za-z]{2}|[0-9]{3}|[A-Za-z]{4}))?$`)
+
+// parseLanguage normalizes a language code (en, eng, pt-br, pt_BR) into a
+// language tag (en, pt-BR). ok is false for unknown languages and for
+// "und" (undetermined).
+func parseLanguage(code string) (tag string, ok bool) {
+	m := languageTagPattern.FindStringSubmatch(code)
+	if m == nil {
+		return "", false
+	}
+
+	base := strings.ToLower(m[1])
+	for _, lang := range languages {
+		if base != lang.code && !slices.Contains(lang.codes, base) {
+			continue
+		}
+		tag = lang.code
+		switch subtag := m[2]; len(subtag) {
+		case 0:
+		case 4:
+			// Script (Hant)
+			tag += "-" + strings.ToUpper(subtag[:1]) + strings.ToLower(subtag[1:])
+		default:
+			tag += "-" + strings.ToUpper(subtag)
+		}
+		return tag, true
+	}
+	return "", false
+}
+
+// languageName returns the English name of a language tag
+// (e.g. "Portuguese (Brazil)"), or the tag itself if it is unknown
+func languageName(tag string) string {
+	base, subtag, _ := strings.Cut(tag, "-")
+	for _, lang := range languages {
+		if lang.code != base {
+			continue
+		}
+		if subtag == "" {
+			return lang.name
+		}
+		if region, ok := regionNames[subtag]; ok {
+			return lang.name + " (" + region + ")"
+		}
+		return lang.name + " (" + subtag + ")"
+	}
+	return tag
+}
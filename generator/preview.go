@@ -0,0 +1,142 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Animated previews: previewSegments clips of previewSegmentLength seconds
+// spread across the video, previewWidth pixels wide
+const (
+	previewSegments      = 4
+	previewSegmentLength = 2.0
+	previewWidth         = 320
+	previewFPS           = 24
+)
+
+// Previews are stored with the thumbnails, named after them (e.g. movie.preview.mp4)
+var previewPatterns = []string{"*.preview.*"}
+
+// Default format of animated previews
+const DefaultPreviewFormat = "mp4"
+
+// Encoder arguments for each preview format. Previews are small and silent;
+// quality matters less than size.
+var previewFormats = map[string][]string{
+	"mp4":  {"-c:v", "libx264", "-preset", "veryfast", "-crf", "30", "-pix_fmt", "yuv420p", "-movflags", "+faststart"},
+	"webm": {"-c:v", "libvpx-vp9", "-crf", "42", "-b:v", "0", "-deadline", "good", "-cpu-used", "5", "-row-mt", "1", "-pix_fmt", "yuv420p"},
+}
+
+// PreviewFormatNames returns the names of the preview formats, sorted
+func PreviewFormatNames() []string {
+	names := make([]string, 0, len(previewFormats))
+	for name := range previewFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetPreviews enables animated previews on the index pages, encoded in
+// format (mp4 or webm)
+func (g *Generator) SetPreviews(format string) error {
+	if _, ok := previewFormats[format]; !ok {
+		return fmt.Errorf("unknown preview format '%s' (available: %s)", format, strings.Join(PreviewFormatNames(), ", "))
+	}
+	g.previewFormat = format
+	return nil
+}
+
+// generatePreviews encodes a short silent clip for each video, made of a
+// few segments spread across it, which plays when hovering over its card.
+// Previews are stored with the thumbnails and reused unless the source
+// file is newer. Videos shorter than the preview are skipped.
+func (g *Generator) generatePreviews() error {
+	dir := filepath.Join(g.outputDir, thumbnailDir)
+	keep := make(map[string]bool)
+
+	if g.previewFormat != "" {
+		if _, err := g.runner.LookPath("ffmpeg"); err != nil {
+			return nil
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+
+		created := 0
+		for _, video := range g.videos {
+			if video.Duration < previewSegments*previewSegmentLength {
+				continue
+			}
+
+			fileName := fileSlug(video.RelativePath) + ".preview." + g.previewFormat
+			previewPath := filepath.Join(dir, fileName)
+			keep[fileName] = true
+
+			if !thumbnailUpToDate(previewPath, video) {
+				fmt.Printf("Generating preview: %s\n", video.FileName)
+				srcPath := filepath.Join(g.rootDir, video.RelativePath)
+				if err := extractPreview(g.runner, srcPath, previewPath, video.Duration, g.previewFormat); err != nil {
+					fmt.Printf("  Warning: Error generating preview for %s: %v\n", video.FileName, err)
+					continue
+				}
+				created++
+			}
+
+			video.Preview = thumbnailDir + "/" + fileName
+		}
+
+		if created > 0 {
+			fmt.Printf("Generated %d previews\n", created)
+		}
+	}
+
+	// Previews of deleted videos, and all of them when disabled or made in another format
+	_, err := pruneFiles(dir, previewPatterns, keep)
+	return err
+}
+
+// previewStarts returns the start times of the preview segments, evenly
+// spread so the first and last segments stay clear of intros and credits
+func previewStarts(duration float64) []float64 {
+	starts := make([]float64, previewSegments)
+	for i := range starts {
+		center := duration * float64(i+1) / float64(previewSegments+1)
+		starts[i] = max(0, min(center-previewSegmentLength/2, duration-previewSegmentLength))
+	}
+	return starts
+}
+
+// extractPreview joins the preview segments of srcPath into previewPath.
+// Each segment is a separate input seeked with -ss, which is much faster
+// than decoding the whole video.
+func extractPreview(r Runner, srcPath, previewPath string, duration float64, format string) error {
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	var filters, labels []string
+	for i, start := range previewStarts(duration) {
+		args = append(args,
+			"-ss", strconv.FormatFloat(start, 'f', 3, 64),
+			"-t", strconv.FormatFloat(previewSegmentLength, 'f', 3, 64),
+			"-i", srcPath,
+		)
+		filters = append(filters, fmt.Sprintf("[%d:v:0]scale=%d:-2,fps=%d,setpts=PTS-STARTPTS[v%d]", i, previewWidth, previewFPS, i))
+		labels = append(labels, fmt.Sprintf("[v%d]", i))
+	}
+	filters = append(filters, fmt.Sprintf("%sconcat=n=%d:v=1:a=0[out]", strings.Join(labels, ""), len(labels)))
+
+	args = append(args, "-filter_complex", strings.Join(filters, ";"), "-map", "[out]", "-an")
+	args = append(args, previewFormats[format]...)
+	args = append(args, "-y", previewPath)
+
+	output, err := r.Command(context.Background(), "ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		os.Remove(previewPath)
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
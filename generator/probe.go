@@ -0,0 +1,254 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// probeOutput is the subset of `ffprobe -print_format json` output we use
+type probeOutput struct {
+	Streams  []probeStream  `json:"streams"`
+	Format   probeFormat    `json:"format"`
+	Chapters []probeChapter `json:"chapters"`
+}
+
+// probeStream describes a single stream of a media file
+type probeStream struct {
+	Index       int               `json:"index"`
+	CodecType   string            `json:"codec_type"`
+	CodecName   string            `json:"codec_name"`
+	Profile     string            `json:"profile"`
+	Level       int               `json:"level"` // -99 when unknown
+	PixFmt      string            `json:"pix_fmt"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	FrameRate   string            `json:"avg_frame_rate"` // e.g. 30000/1001
+	Channels    int               `json:"channels"`
+	Tags        map[string]string `json:"tags"`
+	Disposition map[string]int    `json:"disposition"`
+}
+
+// probeFormat describes the container of a media file
+type probeFormat struct {
+	Duration string            `json:"duration"`
+	BitRate  string            `json:"bit_rate"`
+	Tags     map[string]string `json:"tags"`
+}
+
+// DetailEntry is a label/value pair shown in the player details panel
+type DetailEntry struct {
+	Label string
+	Value string
+}
+
+// probeFile runs ffprobe on path and decodes its JSON output
+func probeFile(r Runner, path string) (*probeOutput, error) {
+	cmd := r.Command(context.Background(), "ffprobe",
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		"-show_chapters",
+		path,
+	)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+
+	var probe probeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, fmt.Errorf("error parsing ffprobe output: %w", err)
+	}
+	return &probe, nil
+}
+
+// applyProbe fills the metadata from ffprobe output
+func (m *Metadata) applyProbe(probe *probeOutput) {
+	m.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	m.Bitrate, _ = strconv.ParseInt(probe.Format.BitRate, 10, 64)
+
+	if created, ok := probe.Format.Tags["creation_time"]; ok {
+		if t, err := time.Parse(time.RFC3339Nano, created); err == nil {
+			m.CreatedAt = t
+		}
+	}
+
+	if stream := probe.videoStream(); stream != nil {
+		m.VideoCodec = stream.CodecName
+		m.VideoProfile = stream.Profile
+		m.VideoLevel = max(stream.Level, 0)
+		m.PixFmt = stream.PixFmt
+		m.Width = stream.Width
+		m.Height = stream.Height
+	}
+
+	if stream := probe.audioStream(); stream != nil {
+		m.AudioCodec = stream.CodecName
+		m.AudioProfile = stream.Profile
+	}
+	for _, stream := range probe.audioStreams() {
+		m.AudioTracks = append(m.AudioTracks, audioTrack(stream))
+	}
+	m.applyChapters(probe.Chapters)
+}
+
+// videoStream returns the main video stream, ignoring embedded cover art
+func (p *probeOutput) videoStream() *probeStream {
+	for i := range p.Streams {
+		stream := &p.Streams[i]
+		if stream.CodecType == "video" && stream.Disposition["attached_pic"] == 0 {
+			return stream
+		}
+	}
+	return nil
+}
+
+// audioStream returns the default audio stream, or the first one if none is marked default
+func (p *probeOutput) audioStream() *probeStream {
+	var first *probeStream
+	for i := range p.Streams {
+		stream := &p.Streams[i]
+		if stream.CodecType != "audio" {
+			continue
+		}
+		if stream.Disposition["default"] == 1 {
+			return stream
+		}
+		if first == nil {
+			first = stream
+		}
+	}
+	return first
+}
+
+// audioStreams returns the audio streams, in file order
+func (p *probeOutput) audioStreams() []*probeStream {
+	var streams []*probeStream
+	for i := range p.Streams {
+		if p.Streams[i].CodecType == "audio" {
+			streams = append(streams, &p.Streams[i])
+		}
+	}
+	return streams
+}
+
+// subtitleStreams returns the subtitle streams, in file order
+func (p *probeOutput) subtitleStreams() []*probeStream {
+	var streams []*probeStream
+	for i := range p.Streams {
+		if p.Streams[i].CodecType == "subtitle" {
+			streams = append(streams, &p.Streams[i])
+		}
+	}
+	return streams
+}
+
+// frameRate returns the average frame rate of the stream, 0 if unknown
+func (s *probeStream) frameRate() float64 {
+	num, den, ok := strings.Cut(s.FrameRate, "/")
+	if !ok {
+		fps, _ := strconv.ParseFloat(s.FrameRate, 64)
+		return fps
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// DurationText returns the duration formatted as H:MM:SS or M:SS
+func (v *Video) DurationText() string {
+	if v.Duration <= 0 {
+		return ""
+	}
+	return formatDuration(v.Duration)
+}
+
+// formatDuration formats seconds as H:MM:SS or M:SS
+func formatDuration(secs float64) string {
+	total := int(secs + 0.5)
+	hours := total / 3600
+	minutes := (total % 3600) / 60
+	seconds := total % 60
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", hours, minutes, seconds)
+	}
+	return fmt.Sprintf("%d:%02d", minutes, seconds)
+}
+
+// Resolution returns the frame size formatted as WIDTHxHEIGHT
+func (v *Video) Resolution() string {
+	if v.Width == 0 || v.Height == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%dx%d", v.Width, v.Height)
+}
+
+// Details returns the metadata shown in the player details panel,
+// skipping values that could not be determined
+func (v *Video) Details() []DetailEntry {
+	candidates := []DetailEntry{
+		{"Duration", v.DurationText()},
+		{"Resolution", v.Resolution()},
+		{"Video codec", v.VideoCodec},
+		{"Audio codec", v.AudioCodec},
+		{"Audio tracks", v.AudioTracksText()},
+		{"Bitrate", formatBitrate(v.Bitrate)},
+		{"File size", formatSize(v.Size)},
+		{"Encodings", v.EncodingsText()},
+		{"Subtitles", v.SubtitlesText()},
+		{"Chapters", v.ChaptersText()},
+		{"Converted", v.ConversionText()},
+	}
+	if !v.CreatedAt.IsZero() {
+		candidates = append(candidates, DetailEntry{"Created", v.CreatedAt.Local().Format("2006-01-02 15:04")})
+	}
+
+	var details []DetailEntry
+	for _, entry := range candidates {
+		if entry.Value != "" {
+			details = append(details, entry)
+		}
+	}
+	return details
+}
+
+// formatSize formats a byte count using binary units
+func formatSize(bytes int64) string {
+	if bytes <= 0 {
+		return ""
+	}
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// formatBitrate formats a bitrate in bits per second
+func formatBitrate(bps int64) string {
+	switch {
+	case bps <= 0:
+		return ""
+	case bps >= 1000000:
+		return fmt.Sprintf("%.1f Mb/s", float64(bps)/1000000)
+	default:
+		return fmt.Sprintf("%d kb/s", bps/1000)
+	}
+}
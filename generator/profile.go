@@ -0,0 +1,217 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Config file looked up in the root directory
+const ConfigFileName = "vsite.json"
+
+// Name of the profile used when none is selected
+const DefaultProfileName = "default"
+
+// x264 presets, fastest first. Other encoders map them to their own presets.
+var encoderPresets = []string{"ultrafast", "superfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow"}
+
+// Video codecs a profile can produce
+var profileCodecs = map[string]bool{"h264": true, "av1": true, "vp9": true}
+
+// Audio bitrates such as 96k or 192k
+var audioBitratePattern = regexp.MustCompile(`^[1-9][0-9]*k$`)
+
+// Profile holds the encoding settings used by --convert. Zero values keep
+// the built-in default for the setting.
+type Profile struct {
+	Codec         string  `json:"codec,omitempty"`          // Video codec (h264, av1 or vp9)
+	Quality       int     `json:"quality,omitempty"`        // CRF (CQ with NVENC), lower is better; 0 uses the encoder default
+	Preset        string  `json:"preset,omitempty"`         // Speed/quality trade-off, x264 names (ultrafast ... veryslow)
+	MaxHeight     int     `json:"max_height,omitempty"`     // Downscale taller videos to this height
+	MaxFPS        float64 `json:"max_fps,omitempty"`        // Reduce higher frame rates to this
+	AudioBitrate  string  `json:"audio_bitrate,omitempty"`  // AAC (Opus for WebM) bitrate (e.g. 128k)
+	AudioChannels int     `json:"audio_channels,omitempty"` // Downmix audio with more channels (e.g. 2 for stereo)
+
+	Name string `json:"-"` // Profile name
+}
+
+// Config is the project configuration (vsite.json)
+type Config struct {
+	Profiles map[string]Profile `json:"profiles"`     // Conversion profiles by name
+	HLS      HLSConfig          `json:"hls,omitzero"` // HLS packaging (--hls)
+}
+
+// DefaultProfile returns the built-in conversion settings
+func DefaultProfile() Profile {
+	return Profile{
+		Name:         DefaultProfileName,
+		Codec:        "h264",
+		Preset:       "fast",
+		AudioBitrate: "128k",
+	}
+}
+
+// Built-in profiles besides the default, which the config file may override.
+// Unset values are taken from the default profile.
+var builtinProfiles = map[string]Profile{
+	"archive": {Quality: 18, Preset: "slow", AudioBitrate: "192k"},
+	"mobile":  {Quality: 26, Preset: "veryfast", MaxHeight: 720, MaxFPS: 30, AudioBitrate: "96k", AudioChannels: 2},
+	"fast":    {Quality: 24, Preset: "ultrafast"},
+}
+
+// LoadConfig reads a config file. A missing file is not an error unless
+// required is set; it results in an empty config (built-in defaults only).
+func LoadConfig(path string, required bool) (*Config, error) {
+	config := &Config{}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !required {
+			return config, nil
+		}
+		return nil, fmt.Errorf("error reading config: %w", err)
+	}
+
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", filepath.Base(path), err)
+	}
+
+	for name, profile := range config.Profiles {
+		profile.Name = name
+		if err := profile.validate(); err != nil {
+			return nil, fmt.Errorf("error in profile '%s': %w", name, err)
+		}
+	}
+	if err := config.HLS.validate(); err != nil {
+		return nil, fmt.Errorf("error in hls settings: %w", err)
+	}
+	return config, nil
+}
+
+// Profile returns the named profile with unset values taken from the
+// built-in default. An empty name selects the default profile. Profiles in
+// the config file replace the built-in ones with the same name.
+func (c *Config) Profile(name string) (Profile, error) {
+	if name == "" {
+		name = DefaultProfileName
+	}
+
+	profile, ok := c.Profiles[name]
+	if !ok {
+		if name == DefaultProfileName {
+			return DefaultProfile(), nil
+		}
+		if profile, ok = builtinProfiles[name]; !ok {
+			return Profile{}, fmt.Errorf("unknown profile '%s' (available: %s)", name, strings.Join(c.ProfileNames(), ", "))
+		}
+	}
+
+	profile.Name = name
+	return profile.withDefaults(), nil
+}
+
+// ProfileNames returns the names of the available profiles, the default
+// first and the others sorted
+func (c *Config) ProfileNames() []string {
+	names := []string{DefaultProfileName}
+	for name := range builtinProfiles {
+		names = append(names, name)
+	}
+	for name := range c.Profiles {
+		if _, builtin := builtinProfiles[name]; !builtin && name != DefaultProfileName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// withDefaults fills unset values from the built-in default profile
+func (p Profile) withDefaults() Profile {
+	defaults := DefaultProfile()
+	if p.Codec == "" {
+		p.Codec = defaults.Codec
+	}
+	if p.Preset == "" {
+		p.Preset = defaults.Preset
+	}
+	if p.AudioBitrate == "" {
+		p.AudioBitrate = defaults.AudioBitrate
+	}
+	return p
+}
+
+// validate checks the values set in the profile
+func (p Profile) validate() error {
+	if p.Codec != "" && !profileCodecs[p.Codec] {
+		return fmt.Errorf("unsupported codec '%s'", p.Codec)
+	}
+	maxQuality := 51
+	if p.Codec == "av1" || p.Codec == "vp9" {
+		maxQuality = 63
+	}
+	if p.Quality < 0 || p.Quality > maxQuality {
+		return fmt.Errorf("quality must be between 1 and %d (or 0 for the encoder default)", maxQuality)
+	}
+	if p.Preset != "" && !slices.Contains(encoderPresets, p.Preset) {
+		return fmt.Errorf("unknown preset '%s' (use one of: %s)", p.Preset, strings.Join(encoderPresets, ", "))
+	}
+	if p.MaxHeight < 0 || p.MaxFPS < 0 || p.AudioChannels < 0 {
+		return fmt.Errorf("max_height, max_fps and audio_channels can't be negative")
+	}
+	if p.AudioBitrate != "" && !audioBitratePattern.MatchString(p.AudioBitrate) {
+		return fmt.Errorf("invalid audio bitrate '%s' (e.g. 128k)", p.AudioBitrate)
+	}
+	return nil
+}
+
+// Summary describes the profile settings in one line
+func (p Profile) Summary() string {
+	parts := []string{p.Codec, "preset " + p.Preset}
+	if p.Quality > 0 {
+		parts = append(parts, fmt.Sprintf("quality %d", p.Quality))
+	}
+	if p.MaxHeight > 0 {
+		parts = append(parts, fmt.Sprintf("max %dp", p.MaxHeight))
+	}
+	if p.MaxFPS > 0 {
+		parts = append(parts, fmt.Sprintf("max %s fps", formatFrameRate(p.MaxFPS)))
+	}
+	audio := "audio " + p.AudioBitrate
+	if p.AudioChannels > 0 {
+		audio += fmt.Sprintf(" %dch", p.AudioChannels)
+	}
+	return strings.Join(append(parts, audio), ", ")
+}
+
+// exceedsVideo reports whether the stream is larger or faster than the
+// profile allows, so it can't be copied as-is
+func (p Profile) exceedsVideo(stream *probeStream) bool {
+	if p.MaxHeight > 0 && stream.Height > p.MaxHeight {
+		return true
+	}
+	return p.MaxFPS > 0 && stream.frameRate() > p.MaxFPS
+}
+
+// exceedsAudio reports whether the stream has more channels than the profile allows
+func (p Profile) exceedsAudio(stream *probeStream) bool {
+	return p.AudioChannels > 0 && stream.Channels > p.AudioChannels
+}
+
+// presetIndex returns the position of the preset from fastest (0) to slowest
+func (p Profile) presetIndex() int {
+	if i := slices.Index(encoderPresets, p.Preset); i >= 0 {
+		return i
+	}
+	return slices.Index(encoderPresets, DefaultProfile().Preset)
+}
+
+// formatFrameRate formats a frame rate without needless decimals (30, 29.97)
+func formatFrameRate(fps float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.3f", fps), "0"), ".")
+}
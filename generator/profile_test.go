@@ -0,0 +1,76 @@
+package generator
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestConfigProfile(t *testing.T) {
+	config := &Config{Profiles: map[string]Profile{
+		"fast":   {Preset: "superfast"},
+		"tiny":   {MaxHeight: 360},
+		"custom": {Codec: "vp9", Quality: 35},
+	}}
+
+	tests := []struct {
+		name string
+		want Profile
+	}{
+		{"", DefaultProfile()},
+		{"default", DefaultProfile()},
+		{"mobile", Profile{Name: "mobile", Codec: "h264", Quality: 26, Preset: "veryfast", MaxHeight: 720, MaxFPS: 30, AudioBitrate: "96k", AudioChannels: 2}},
+		{"archive", Profile{Name: "archive", Codec: "h264", Quality: 18, Preset: "slow", AudioBitrate: "192k"}},
+		{"fast", Profile{Name: "fast", Codec: "h264", Preset: "superfast", AudioBitrate: "128k"}}, // Replaced by the config file
+		{"custom", Profile{Name: "custom", Codec: "vp9", Quality: 35, Preset: "fast", AudioBitrate: "128k"}},
+	}
+
+	for _, tt := range tests {
+		got, err := config.Profile(tt.name)
+		if err != nil {
+			t.Errorf("Profile(%q) = %v", tt.name, err)
+		} else if got != tt.want {
+			t.Errorf("Profile(%q) = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := config.Profile("missing"); err == nil || !strings.Contains(err.Error(), "available: default, archive, custom, fast, mobile, tiny") {
+		t.Errorf("Profile(missing) = %v, want an error listing the profiles", err)
+	}
+	if got, want := (&Config{}).ProfileNames(), []string{"default", "archive", "fast", "mobile"}; !slices.Equal(got, want) {
+		t.Errorf("ProfileNames() without a config = %q, want %q", got, want)
+	}
+}
+
+func TestProfileValidate(t *testing.T) {
+	tests := []struct {
+		profile Profile
+		wantErr string // Substring of the error, empty if valid
+	}{
+		{DefaultProfile(), ""},
+		{Profile{Quality: 51}, ""},
+		{Profile{Codec: "av1", Quality: 63}, ""},
+		{Profile{Quality: 52}, "quality must be between 1 and 51 (or 0 for the encoder default)"},
+		{Profile{Codec: "vp9", Quality: -1}, "quality must be between 1 and 63"},
+		{Profile{Codec: "hevc"}, "unsupported codec 'hevc'"},
+		{Profile{Preset: "turbo"}, "unknown preset 'turbo'"},
+		{Profile{MaxHeight: -1}, "can't be negative"},
+		{Profile{AudioBitrate: "128"}, "invalid audio bitrate '128'"},
+	}
+
+	for _, tt := range tests {
+		err := tt.profile.validate()
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("validate(%+v) = %v, want nil", tt.profile, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("validate(%+v) = %v, want error containing %q", tt.profile, err, tt.wantErr)
+		}
+	}
+
+	for name, profile := range builtinProfiles {
+		if err := profile.validate(); err != nil {
+			t.Errorf("built-in profile %s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package generator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Width of the progress bar in characters
+const progressBarWidth = 24
+
+// Longest file name shown next to a progress bar
+const progressNameWidth = 32
+
+// How often plain (non-terminal) output reports progress of a video with unknown duration
+const plainProgressInterval = 30 * time.Second
+
+// progressDisplay shows the progress of running conversions. On a terminal,
+// each running job gets a progress bar that is redrawn in place, followed by
+// the batch ETA. When output is redirected, it falls back to plain log lines.
+type progressDisplay struct {
+	mu         sync.Mutex
+	tty        bool
+	verb       string         // What a job does, e.g. "Converting"
+	total      int            // Videos in the batch
+	finished   int            // Videos already converted (or failed)
+	jobs       []*jobProgress // Running jobs, in start order
+	started    time.Time      // Batch start
+	totalMedia float64        // Sum of known durations, in seconds
+	doneMedia  float64        // Media seconds of finished jobs
+	lines      int            // Lines currently drawn (terminal only)
+}
+
+// jobProgress is the state of a single running conversion
+type jobProgress struct {
+	prefix    string    // e.g. "[2/10]"
+	name      string    // File name
+	duration  float64   // Duration in seconds (0 if unknown)
+	outTime   float64   // Media seconds processed
+	speed     float64   // Encoding speed relative to playback (e.g. 2.5x)
+	lastStep  int       // Last 10% step reported (plain output)
+	lastPrint time.Time // Last plain report
+}
+
+// newProgressDisplay creates a display for a batch of videos with the given
+// durations. verb describes the jobs in the log (e.g. "Converting").
+func newProgressDisplay(verb string, durations []float64) *progressDisplay {
+	d := &progressDisplay{
+		tty:     isTerminal(os.Stdout),
+		verb:    verb,
+		total:   len(durations),
+		started: time.Now(),
+	}
+	for _, duration := range durations {
+		d.totalMedia += duration
+	}
+	return d
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// start registers a running job
+func (d *progressDisplay) start(index int, name string, duration float64) *jobProgress {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	job := &jobProgress{
+		prefix:    fmt.Sprintf("[%d/%d]", index+1, d.total),
+		name:      name,
+		duration:  duration,
+		lastPrint: time.Now(),
+	}
+	d.jobs = append(d.jobs, job)
+
+	d.logLocked(fmt.Sprintf("%s %s: %s", job.prefix, d.verb, name))
+	return job
+}
+
+// update records the progress reported by ffmpeg for a job
+func (d *progressDisplay) update(job *jobProgress, outTime, speed float64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	job.outTime = outTime
+	if speed > 0 {
+		job.speed = speed
+	}
+
+	if d.tty {
+		d.redrawLocked()
+		return
+	}
+
+	// Plain output: one line per 10% (or periodically when the duration is unknown)
+	if job.duration > 0 {
+		step := int(job.percent() / 10)
+		if step > job.lastStep && step < 10 {
+			job.lastStep = step
+			fmt.Printf("%s %s: %s\n", job.prefix, job.name, job.status())
+		}
+	} else if time.Since(job.lastPrint) >= plainProgressInterval {
+		job.lastPrint = time.Now()
+		fmt.Printf("%s %s: %s\n", job.prefix, job.name, job.status())
+	}
+}
+
+// finish removes a job from the display and prints its outcome
+func (d *progressDisplay) finish(job *jobProgress, message string, details []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i, j := range d.jobs {
+		if j == job {
+			d.jobs = append(d.jobs[:i], d.jobs[i+1:]...)
+			break
+		}
+	}
+	d.finished++
+	d.doneMedia += job.duration
+
+	lines := []string{message}
+	for _, detail := range details {
+		lines = append(lines, "    "+detail)
+	}
+	d.logLocked(strings.Join(lines, "\n"))
+}
+
+// requeue removes a job that will run again later, printing message
+func (d *progressDisplay) requeue(job *jobProgress, message string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i, j := range d.jobs {
+		if j == job {
+			d.jobs = append(d.jobs[:i], d.jobs[i+1:]...)
+			break
+		}
+	}
+	d.logLocked(message)
+}
+
+// restart resets the progress of a job that starts over, printing message
+func (d *progressDisplay) restart(job *jobProgress, message string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	job.outTime = 0
+	job.speed = 0
+	job.lastStep = 0
+	job.lastPrint = time.Now()
+	d.logLocked(message)
+}
+
+// logLocked prints a message above the progress bars
+func (d *progressDisplay) logLocked(message string) {
+	if !d.tty {
+		fmt.Println(message)
+		return
+	}
+	d.clearLocked()
+	fmt.Println(message)
+	d.redrawLocked()
+}
+
+// clearLocked erases the progress bars (terminal only)
+func (d *progressDisplay) clearLocked() {
+	if d.lines > 0 {
+		fmt.Printf("\033[%dA\033[J", d.lines)
+		d.lines = 0
+	}
+}
+
+// redrawLocked draws a progress bar per running job and the batch ETA (terminal only)
+func (d *progressDisplay) redrawLocked() {
+	d.clearLocked()
+	if len(d.jobs) == 0 {
+		return
+	}
+
+	for _, job := range d.jobs {
+		fmt.Printf("%s %-*s %s\n", job.prefix, progressNameWidth, truncateName(job.name, progressNameWidth), job.bar())
+		d.lines++
+	}
+
+	summary := fmt.Sprintf("Total: %d/%d done", d.finished, d.total)
+	if eta, ok := d.batchETA(); ok {
+		summary += ", ETA " + formatETA(eta)
+	}
+	fmt.Println(summary)
+	d.lines++
+}
+
+// batchETA estimates the time left for the whole batch from the media
+// throughput so far. It is unknown until some progress has been made.
+func (d *progressDisplay) batchETA() (time.Duration, bool) {
+	processed := d.doneMedia
+	for _, job := range d.jobs {
+		if job.duration > 0 {
+			processed += min(job.outTime, job.duration)
+		}
+	}
+
+	elapsed := time.Since(d.started).Seconds()
+	if d.totalMedia <= 0 || processed <= 0 || elapsed <= 0 {
+		return 0, false
+	}
+
+	rate := processed / elapsed
+	remaining := max(d.totalMedia-processed, 0)
+	return time.Duration(remaining / rate * float64(time.Second)), true
+}
+
+// percent returns how much of the job is done (0 if the duration is unknown)
+func (j *jobProgress) percent() float64 {
+	if j.duration <= 0 {
+		return 0
+	}
+	return min(j.outTime/j.duration*100, 100)
+}
+
+// eta estimates the time left for the job
+func (j *jobProgress) eta() (time.Duration, bool) {
+	if j.duration <= 0 || j.speed <= 0 {
+		return 0, false
+	}
+	remaining := max(j.duration-j.outTime, 0) / j.speed
+	return time.Duration(remaining * float64(time.Second)), true
+}
+
+// bar renders the progress bar with percent, speed and ETA
+func (j *jobProgress) bar() string {
+	if j.duration <= 0 {
+		return j.status()
+	}
+	filled := int(j.percent() / 100 * progressBarWidth)
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled) + "] " + j.status()
+}
+
+// status describes the job progress in words
+func (j *jobProgress) status() string {
+	var parts []string
+	if j.duration > 0 {
+		parts = append(parts, fmt.Sprintf("%5.1f%%", j.percent()))
+	} else {
+		parts = append(parts, formatClock(j.outTime)+" processed")
+	}
+	if j.speed > 0 {
+		parts = append(parts, fmt.Sprintf("%.2fx", j.speed))
+	}
+	if eta, ok := j.eta(); ok {
+		parts = append(parts, "ETA "+formatETA(eta))
+	}
+	return strings.Join(parts, "  ")
+}
+
+// truncateName shortens name to width characters
+func truncateName(name string, width int) string {
+	runes := []rune(name)
+	if len(runes) <= width {
+		return name
+	}
+	return string(runes[:width-3]) + "..."
+}
+
+// formatETA formats a remaining time compactly (e.g. 1h02m, 3m12s, 45s)
+func formatETA(d time.Duration) string {
+	d = d.Round(time.Second)
+	hours := int(d.Hours())
+	minutes := int(d.Minutes()) % 60
+	seconds := int(d.Seconds()) % 60
+	switch {
+	case hours > 0:
+		return fmt.Sprintf("%dh%02dm", hours, minutes)
+	case minutes > 0:
+		return fmt.Sprintf("%dm%02ds", minutes, seconds)
+	default:
+		return fmt.Sprintf("%ds", seconds)
+	}
+}
+
+// formatClock formats seconds as HH:MM:SS
+func formatClock(seconds float64) string {
+	total := int(seconds)
+	return fmt.Sprintf("%02d:%02d:%02d", total/3600, (total%3600)/60, total%60)
+}
+
+// readProgress parses ffmpeg's machine-readable progress (-progress pipe:1)
+// and calls report at the end of each block with the media time processed
+// (in seconds) and the encoding speed
+func readProgress(r io.Reader, report func(outTime, speed float64)) {
+	var outTime, speed float64
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "out_time_us", "out_time_ms":
+			// Both are in microseconds (out_time_ms is misnamed)
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+				outTime = float64(us) / 1e6
+			}
+		case "speed":
+			speed, _ = strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "x"), 64)
+		case "progress":
+			report(outTime, speed)
+		}
+	}
+}
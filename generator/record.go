@@ -0,0 +1,146 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Conversion records file (relative to output). Unlike the metadata cache,
+// it describes the media files, so --clean keeps it.
+const conversionsFile = ".vsite/conversions.json"
+
+// conversionRecord describes how vsite produced a converted file
+type conversionRecord struct {
+	Source       string    `json:"source"`                  // Original file (relative to root)
+	Method       string    `json:"method"`                  // How streams were handled (e.g. "remux")
+	Encoder      string    `json:"encoder"`                 // Encoder backend, "copy" if the video was copied
+	FallbackFrom string    `json:"fallback_from,omitempty"` // Hardware encoder that failed first
+	Profile      string    `json:"profile"`                 // Conversion profile name
+	Converted    time.Time `json:"converted"`               // When the conversion finished
+	Subtitles    []string  `json:"subtitles,omitempty"`     // Subtitle sidecars extracted from the source
+}
+
+// loadConversions reads the conversion records, keyed by the slash relative
+// path of the converted file. Missing or unreadable records are empty.
+func loadConversions(path string) map[string]conversionRecord {
+	records := make(map[string]conversionRecord)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("Warning: Error reading conversion records: %v\n", err)
+		}
+		return records
+	}
+	if err := json.Unmarshal(data, &records); err != nil {
+		fmt.Printf("Warning: Ignoring corrupt conversion records: %v\n", err)
+		return make(map[string]conversionRecord)
+	}
+	return records
+}
+
+// recordConversions adds the successful conversions to the records, which
+// keep which encoder produced each file. Records of deleted files are dropped.
+func (g *Generator) recordConversions(results []conversionResult, profile Profile) error {
+	path := filepath.Join(g.outputDir, conversionsFile)
+	records := loadConversions(path)
+
+	for key := range records {
+		if _, err := os.Stat(filepath.Join(g.rootDir, filepath.FromSlash(key))); err != nil {
+			delete(records, key)
+		}
+	}
+
+	for _, result := range results {
+		if result.err != nil {
+			continue
+		}
+		output, err := filepath.Rel(g.rootDir, result.output)
+		if err != nil {
+			return err
+		}
+		source := result.source
+		if source == result.output {
+			// Converted in place, the original was moved aside
+			source += originalSuffix
+		}
+		if source, err = filepath.Rel(g.rootDir, source); err != nil {
+			return err
+		}
+		var subtitles []string
+		for _, path := range result.subtitles {
+			if rel, err := filepath.Rel(g.rootDir, path); err == nil {
+				subtitles = append(subtitles, filepath.ToSlash(rel))
+			}
+		}
+
+		records[cacheKey(output)] = conversionRecord{
+			Source:       filepath.ToSlash(source),
+			Method:       result.method,
+			Encoder:      result.encoder,
+			FallbackFrom: result.fallbackFrom,
+			Profile:      profile.Name,
+			Converted:    time.Now(),
+			Subtitles:    subtitles,
+		}
+	}
+
+	return saveConversions(path, records)
+}
+
+// saveConversions writes the conversion records to path
+func saveConversions(path string, records map[string]conversionRecord) error {
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so an interrupted run can't corrupt the records
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// applyConversionRecords attaches the conversion records to the videos
+func (g *Generator) applyConversionRecords() {
+	records := loadConversions(filepath.Join(g.outputDir, conversionsFile))
+	for _, video := range g.videos {
+		if record, ok := records[cacheKey(video.RelativePath)]; ok {
+			video.conversion = &record
+		}
+	}
+}
+
+// ConversionText describes how vsite converted the video (e.g. "from
+// movie.mkv with libx264, default profile"), empty if it wasn't converted
+func (v *Video) ConversionText() string {
+	record := v.conversion
+	if record == nil {
+		return ""
+	}
+
+	var encoder string
+	switch {
+	case record.Encoder == "copy":
+		encoder = "video copied"
+	case record.FallbackFrom != "":
+		encoder = fmt.Sprintf("with %s (%s failed)", record.Encoder, record.FallbackFrom)
+	default:
+		encoder = "with " + record.Encoder
+	}
+
+	source := record.Source[strings.LastIndex(record.Source, "/")+1:]
+	return fmt.Sprintf("from %s, %s, %s profile", source, encoder, record.Profile)
+}
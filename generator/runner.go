@@ -0,0 +1,31 @@
+package generator
+
+import (
+	"context"
+	"os/exec"
+)
+
+// Runner starts the external programs vsite depends on (ffmpeg, ffprobe,
+// nvidia-smi). It can be replaced with SetRunner, e.g. to run a fake ffmpeg.
+type Runner interface {
+	// LookPath reports where a program is installed, like exec.LookPath
+	LookPath(name string) (string, error)
+	// Command prepares a program to run with args; it is killed when ctx is done
+	Command(ctx context.Context, name string, args ...string) *exec.Cmd
+}
+
+// execRunner runs programs found in PATH
+type execRunner struct{}
+
+func (execRunner) LookPath(name string) (string, error) {
+	return exec.LookPath(name)
+}
+
+func (execRunner) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, name, args...)
+}
+
+// output runs a program to completion and returns its standard output
+func output(r Runner, name string, args ...string) ([]byte, error) {
+	return r.Command(context.Background(), name, args...).Output()
+}
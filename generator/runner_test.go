@@ -0,0 +1,149 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRunner runs this test binary in place of ffmpeg, ffprobe and
+// nvidia-smi (see TestHelperProcess). The FAKE_* variables in env decide
+// how the fake programs behave; programs in missing are not found.
+type fakeRunner struct {
+	env     []string
+	missing map[string]bool
+
+	mu    sync.Mutex
+	calls [][]string // Program and arguments of each command, in order
+}
+
+func (f *fakeRunner) LookPath(name string) (string, error) {
+	if f.missing[name] {
+		return "", exec.ErrNotFound
+	}
+	return "/usr/bin/" + name, nil
+}
+
+func (f *fakeRunner) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	f.mu.Lock()
+	f.calls = append(f.calls, append([]string{name}, args...))
+	f.mu.Unlock()
+
+	cmd := exec.CommandContext(ctx, os.Args[0], append([]string{"-test.run=^TestHelperProcess$", "--", name}, args...)...)
+	cmd.Env = append(append(os.Environ(), "VSITE_HELPER_PROCESS=1"), f.env...)
+	return cmd
+}
+
+// encodes returns the video encoder of each ffmpeg conversion, in order
+// ("copy" when the video was copied)
+func (f *fakeRunner) encodes() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var encoders []string
+	for _, call := range f.calls {
+		if call[0] != "ffmpeg" {
+			continue
+		}
+		if i := slices.Index(call, "-c:v"); i >= 0 && slices.Contains(call, "-progress") {
+			encoders = append(encoders, call[i+1])
+		}
+	}
+	return encoders
+}
+
+// TestHelperProcess is not a real test: it is the fake ffmpeg, ffprobe and
+// nvidia-smi started by fakeRunner
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("VSITE_HELPER_PROCESS") != "1" {
+		return
+	}
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	if len(args) < 2 {
+		os.Exit(2)
+	}
+	os.Exit(fakeProgram(args[1], args[2:]))
+}
+
+// fakeProgram behaves like the named program and returns its exit code
+func fakeProgram(name string, args []string) int {
+	switch name {
+	case "nvidia-smi":
+		// FAKE_GPU: name of the GPU, empty when there is none
+		fmt.Println(os.Getenv("FAKE_GPU"))
+		return 0
+	case "ffprobe":
+		// FAKE_PROBE: JSON output for every file
+		fmt.Println(os.Getenv("FAKE_PROBE"))
+		return 0
+	case "ffmpeg":
+		return fakeFFmpeg(args)
+	default:
+		fmt.Fprintf(os.Stderr, "%s: not faked\n", name)
+		return 127
+	}
+}
+
+// fakeFFmpeg lists the encoders in FAKE_ENCODERS, or "converts" the input
+// by writing the output file. Conversions with the encoder in
+// FAKE_FAIL_ENCODER fail, FAKE_STALL=1 makes them hang without progress and
+// FAKE_SESSION_LIMIT (once or always) makes NVENC encodes fail with the
+// session limit error (once per output file, or every time).
+func fakeFFmpeg(args []string) int {
+	if slices.Contains(args, "-encoders") {
+		fmt.Println("Encoders:")
+		for _, name := range strings.Fields(os.Getenv("FAKE_ENCODERS")) {
+			fmt.Printf(" V....D %-20s Fake encoder\n", name)
+		}
+		return 0
+	}
+
+	dst := args[len(args)-1]
+	encoder := ""
+	if i := slices.Index(args, "-c:v"); i >= 0 {
+		encoder = args[i+1]
+	}
+
+	if fail := os.Getenv("FAKE_FAIL_ENCODER"); fail != "" && encoder == fail {
+		fmt.Fprintf(os.Stderr, "[%s @ 0x1234] Error while opening encoder\n", encoder)
+		return 1
+	}
+	if encoder == "h264_nvenc" {
+		limited := false
+		switch os.Getenv("FAKE_SESSION_LIMIT") {
+		case "always":
+			limited = true
+		case "once":
+			marker := dst + ".limited"
+			if _, err := os.Stat(marker); err != nil {
+				os.WriteFile(marker, nil, 0644)
+				limited = true
+			}
+		}
+		if limited {
+			fmt.Fprintln(os.Stderr, "[h264_nvenc @ 0x1234] OpenEncodeSessionEx failed: incompatible client key (21): (no details)")
+			return 1
+		}
+	}
+	if os.Getenv("FAKE_STALL") == "1" {
+		fmt.Println("out_time_us=0\nprogress=continue")
+		time.Sleep(time.Minute)
+		return 0
+	}
+
+	fmt.Println("out_time_us=10000000\nspeed=4.0x\nprogress=end")
+	if err := os.WriteFile(dst, []byte("converted"), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
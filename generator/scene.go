@@ -0,0 +1,159 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default minimum time between automatic chapters
+const DefaultChapterSpacing = 5 * time.Minute
+
+// Scene change score (0-1) above which a frame starts a new scene
+const sceneThreshold = 0.4
+
+// Frame times printed by ffmpeg's metadata filter (frame:12 pts:6006 pts_time:6.006)
+var ptsTimePattern = regexp.MustCompile(`pts_time:([0-9.]+)`)
+
+// SetAutoChapters enables chapter detection for videos without chapters.
+// Chapters start at scene changes at least spacing apart.
+func (g *Generator) SetAutoChapters(spacing time.Duration) {
+	g.chapterSpacing = spacing
+}
+
+// detectChapters proposes chapters at scene changes for videos that have
+// none. Detected chapters are kept in the metadata cache, so each video is
+// analyzed once (again if the spacing changes). Without --auto-chapters,
+// chapters detected in earlier runs are hidden.
+func (g *Generator) detectChapters() {
+	spacing := g.chapterSpacing.Seconds()
+	if spacing == 0 {
+		for _, video := range g.videos {
+			if video.ChapterSpacing > 0 {
+				video.Chapters = nil
+			}
+		}
+		return
+	}
+	if _, err := g.runner.LookPath("ffmpeg"); err != nil {
+		fmt.Println("ffmpeg not found, skipping chapter detection")
+		return
+	}
+
+	detected := 0
+	for _, video := range g.videos {
+		if len(video.Chapters) > 0 && video.ChapterSpacing == 0 {
+			// Chapters from the container
+			continue
+		}
+		if video.ChapterSpacing == spacing {
+			continue
+		}
+		if video.Duration < 2*spacing {
+			// Too short for two chapters
+			video.Chapters = nil
+			continue
+		}
+
+		fmt.Printf("Detecting scenes: %s\n", video.FileName)
+		changes, err := detectSceneChanges(g.runner, filepath.Join(g.rootDir, video.RelativePath))
+		if err != nil {
+			fmt.Printf("  Warning: Error detecting scenes in %s: %v\n", video.FileName, err)
+			continue
+		}
+		video.Chapters = sceneChapters(changes, video.Duration, spacing)
+		video.ChapterSpacing = spacing
+		g.cache.update(video.RelativePath, video.Metadata)
+		detected++
+	}
+
+	if detected > 0 {
+		fmt.Printf("Detected chapters in %d videos\n", detected)
+	}
+}
+
+// detectSceneChanges returns the times (in seconds) where the picture
+// changes enough to start a new scene. Frames are scaled down first, which
+// makes the analysis much faster without affecting the scores much.
+func detectSceneChanges(r Runner, srcPath string) ([]float64, error) {
+	cmd := r.Command(context.Background(), "ffmpeg",
+		"-hide_banner",
+		"-loglevel", "error",
+		"-i", srcPath,
+		"-map", "0:v:0",
+		"-vf", fmt.Sprintf("scale=160:-2,select='gt(scene,%g)',metadata=print:file=-", sceneThreshold),
+		"-f", "null",
+		"-",
+	)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+
+	var changes []float64
+	for _, m := range ptsTimePattern.FindAllStringSubmatch(string(output), -1) {
+		if t, err := strconv.ParseFloat(m[1], 64); err == nil {
+			changes = append(changes, t)
+		}
+	}
+	return changes, nil
+}
+
+// sceneChapters turns scene changes into chapters: the first starts at the
+// beginning, and each next one at the first scene change at least spacing
+// after the previous one (and before the end). Nil if no chapter fits.
+func sceneChapters(changes []float64, duration, spacing float64) []Chapter {
+	starts := []float64{0}
+	for _, t := range changes {
+		if t-starts[len(starts)-1] >= spacing && duration-t >= spacing {
+			starts = append(starts, t)
+		}
+	}
+	if len(starts) < 2 {
+		return nil
+	}
+
+	chapters := make([]Chapter, len(starts))
+	for i, start := range starts {
+		end := duration
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		chapters[i] = Chapter{Start: start, End: end, Title: fmt.Sprintf("Chapter %d", i+1)}
+	}
+	return chapters
+}
+
+// generateChapterThumbnails extracts a frame at the start of each detected
+// chapter into dir, reusing thumbnails that are newer than the video
+func (g *Generator) generateChapterThumbnails(video *Video, dir string, keep map[string]bool) {
+	if _, err := g.runner.LookPath("ffmpeg"); err != nil {
+		return
+	}
+	srcPath := filepath.Join(g.rootDir, video.RelativePath)
+	for i := range video.Chapters {
+		chapter := &video.Chapters[i]
+		// Named after the start time, so moved chapters get new thumbnails
+		fileName := fmt.Sprintf("%s.%d.jpg", fileSlug(video.RelativePath), int(chapter.Start))
+		thumbPath := filepath.Join(dir, fileName)
+		keep[fileName] = true
+
+		if !thumbnailUpToDate(thumbPath, video) {
+			// Just after the cut, so the frame belongs to the new scene
+			offset := strconv.FormatFloat(chapter.Start+0.5, 'f', 3, 64)
+			if err := extractThumbnail(g.runner, srcPath, thumbPath, []string{offset}); err != nil {
+				fmt.Printf("  Warning: Error generating chapter thumbnail for %s: %v\n", video.FileName, err)
+				continue
+			}
+		}
+		chapter.Thumbnail = chapterDir + "/" + fileName
+	}
+}
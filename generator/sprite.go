@@ -0,0 +1,148 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Directory (relative to output) where seek-bar previews are stored
+const spriteDir = ".vsite/sprites"
+
+// Generated files in spriteDir: sprite sheets and their WebVTT files
+var spritePatterns = []string{"*.jpg", "*.vtt"}
+
+// Seek-bar preview frame width in pixels (height keeps the aspect ratio)
+const spriteFrameWidth = 160
+
+// Frames per row of a sprite sheet
+const spriteColumns = 10
+
+// Time between preview frames. Longer videos use a longer interval so the
+// sheet holds at most spriteMaxFrames.
+const (
+	spriteInterval  = 10 * time.Second
+	spriteMaxFrames = 300
+)
+
+// spriteLayout describes the frames of a sprite sheet
+type spriteLayout struct {
+	interval      float64 // Seconds between frames
+	frames        int     // Number of frames
+	width, height int     // Frame size in pixels
+}
+
+// newSpriteLayout returns the layout for a video, ok is false if its
+// duration or frame size is unknown
+func newSpriteLayout(video *Video) (layout spriteLayout, ok bool) {
+	if video.Duration <= 0 || video.Width <= 0 || video.Height <= 0 {
+		return layout, false
+	}
+	layout.interval = max(spriteInterval.Seconds(), math.Ceil(video.Duration/spriteMaxFrames))
+	layout.frames = int(math.Ceil(video.Duration / layout.interval))
+	layout.width = spriteFrameWidth
+	// Same rounding as scale=W:-2 (nearest even height)
+	layout.height = int(math.Round(float64(spriteFrameWidth*video.Height)/float64(video.Width)/2)) * 2
+	return layout, true
+}
+
+// generateSprites builds, for each video, a sprite sheet of frames taken at
+// a fixed interval and a WebVTT file mapping time ranges to frames, which
+// the player shows while hovering over the progress bar. Existing sprites
+// are reused unless the source file is newer.
+func (g *Generator) generateSprites() error {
+	if _, err := g.runner.LookPath("ffmpeg"); err != nil {
+		return nil
+	}
+
+	dir := filepath.Join(g.outputDir, spriteDir)
+	keep := make(map[string]bool)
+	created := 0
+
+	for _, video := range g.videos {
+		layout, ok := newSpriteLayout(video)
+		if !ok {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+
+		slug := fileSlug(video.RelativePath)
+		sheetPath := filepath.Join(dir, slug+".jpg")
+		vttPath := filepath.Join(dir, slug+".vtt")
+		keep[slug+".jpg"], keep[slug+".vtt"] = true, true
+
+		if !thumbnailUpToDate(sheetPath, video) || !thumbnailUpToDate(vttPath, video) {
+			fmt.Printf("Generating seek previews: %s\n", video.FileName)
+			srcPath := filepath.Join(g.rootDir, video.RelativePath)
+			if err := extractSprite(g.runner, srcPath, sheetPath, layout); err != nil {
+				fmt.Printf("  Warning: Error generating seek previews for %s: %v\n", video.FileName, err)
+				os.Remove(vttPath)
+				continue
+			}
+			if err := os.WriteFile(vttPath, spriteWebVTT(slug+".jpg", layout), 0644); err != nil {
+				return err
+			}
+			created++
+		}
+
+		video.Sprites = spriteDir + "/" + slug + ".vtt"
+	}
+
+	if created > 0 {
+		fmt.Printf("Generated %d seek previews\n", created)
+	}
+
+	_, err := pruneFiles(dir, spritePatterns, keep)
+	return err
+}
+
+// extractSprite tiles frames of srcPath taken every layout.interval seconds
+// into a single image. Only keyframes are decoded, which is much faster
+// than decoding every frame; each tile shows the last keyframe before its time.
+func extractSprite(r Runner, srcPath, sheetPath string, layout spriteLayout) error {
+	rows := (layout.frames + spriteColumns - 1) / spriteColumns
+	cmd := r.Command(context.Background(), "ffmpeg",
+		"-hide_banner",
+		"-loglevel", "error",
+		"-skip_frame", "nokey",
+		"-i", srcPath,
+		"-map", "0:v:0",
+		"-vf", fmt.Sprintf("fps=1/%g,scale=%d:%d,tile=%dx%d", layout.interval, layout.width, layout.height, spriteColumns, rows),
+		"-frames:v", "1",
+		"-q:v", "5",
+		"-y",
+		sheetPath,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(sheetPath)
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	if info, err := os.Stat(sheetPath); err != nil || info.Size() == 0 {
+		os.Remove(sheetPath)
+		return fmt.Errorf("no frames extracted")
+	}
+	return nil
+}
+
+// spriteWebVTT maps each interval to its frame in the sheet
+// (sheet.jpg#xywh=x,y,w,h), the format of WebVTT thumbnail tracks
+func spriteWebVTT(sheet string, layout spriteLayout) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("WEBVTT\n")
+	interval := time.Duration(layout.interval * float64(time.Second))
+	for i := range layout.frames {
+		x := (i % spriteColumns) * layout.width
+		y := (i / spriteColumns) * layout.height
+		start := time.Duration(i) * interval
+		fmt.Fprintf(&buf, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n", formatVTTTime(start), formatVTTTime(start+interval),
+			sheet, x, y, layout.width, layout.height)
+	}
+	return buf.Bytes()
+}
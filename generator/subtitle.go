@@ -0,0 +1,364 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Directory (relative to output) where subtitles are stored as WebVTT
+const subtitleDir = ".vsite/subtitles"
+
+// Generated files in subtitleDir
+var subtitlePatterns = []string{"*.vtt"}
+
+// Subtitle files found next to videos
+var subtitleExtensions = map[string]bool{
+	".vtt": true,
+	".srt": true,
+	".ass": true,
+	".ssa": true,
+}
+
+// Subtitle is a subtitle track of a video, from a sidecar file such as
+// movie.srt, movie.en.vtt or movie.pt-BR.forced.srt
+type Subtitle struct {
+	Src      string // WebVTT file (relative to output)
+	Language string // Language tag (e.g. pt-BR), empty if unknown
+	Label    string // Name shown in the player menu
+	Default  bool   // Enabled when playback starts
+
+	source  string    // Sidecar file (relative to root)
+	suffix  string    // Part of the sidecar name after the video name (e.g. "pt-BR.forced")
+	forced  bool      // Only translates foreign dialogue
+	sdh     bool      // Includes sound descriptions (SDH/CC)
+	modTime time.Time // Sidecar modification time
+}
+
+// sidecarFile is a subtitle file found while scanning
+type sidecarFile struct {
+	relPath string
+	modTime time.Time
+}
+
+// SetSubtitleLanguage sets the language (e.g. en or pt-BR) of the subtitle
+// track enabled by default. Without it, subtitles start disabled.
+func (g *Generator) SetSubtitleLanguage(lang string) {
+	g.subtitleLang = lang
+}
+
+// attachSubtitles assigns sidecar files to the video they are named after:
+// movie.en.srt belongs to movie.mp4 (or to movie.webm)
+func (g *Generator) attachSubtitles(sidecars []sidecarFile) {
+	for _, sidecar := range sidecars {
+		dir := filepath.Dir(sidecar.relPath)
+		if dir == "." {
+			dir = ""
+		}
+		name := filepath.Base(sidecar.relPath)
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+
+		// Longest matching name, so movie.part2.srt goes to movie.part2.mp4 and not movie.mp4
+		var video *Video
+		for _, v := range g.dirTree[dir] {
+			if (name == v.Name || strings.HasPrefix(name, v.Name+".")) && (video == nil || len(v.Name) > len(video.Name)) {
+				video = v
+			}
+		}
+		if video == nil {
+			continue
+		}
+
+		subtitle := parseSubtitleName(strings.TrimPrefix(strings.TrimPrefix(name, video.Name), "."))
+		subtitle.source = sidecar.relPath
+		subtitle.modTime = sidecar.modTime
+		video.Subtitles = append(video.Subtitles, subtitle)
+	}
+
+	for _, video := range g.videos {
+		if len(video.Subtitles) > 0 {
+			video.Subtitles = g.arrangeSubtitles(video.Subtitles)
+		}
+	}
+}
+
+// parseSubtitleName reads the language and flags from the part of a
+// sidecar name after the video name (e.g. "pt-BR.forced" or "eng.sdh")
+func parseSubtitleName(suffix string) Subtitle {
+	subtitle := Subtitle{suffix: suffix}
+	if suffix == "" {
+		return subtitle
+	}
+	for _, part := range strings.Split(suffix, ".") {
+		switch strings.ToLower(part) {
+		case "forced":
+			subtitle.forced = true
+		case "sdh", "cc":
+			subtitle.sdh = true
+		default:
+			if tag, ok := parseLanguage(part); ok && subtitle.Language == "" {
+				subtitle.Language = tag
+			}
+		}
+	}
+	return subtitle
+}
+
+// arrangeSubtitles drops sidecars duplicating another one (movie.en.srt
+// next to movie.en.vtt), sorts the tracks by label and marks the default one
+func (g *Generator) arrangeSubtitles(subtitles []Subtitle) []Subtitle {
+	// WebVTT first, it needs no conversion
+	sort.SliceStable(subtitles, func(i, j int) bool {
+		return strings.EqualFold(filepath.Ext(subtitles[i].source), ".vtt") && !strings.EqualFold(filepath.Ext(subtitles[j].source), ".vtt")
+	})
+	var unique []Subtitle
+	seen := make(map[string]bool)
+	for _, subtitle := range subtitles {
+		key := strings.ToLower(subtitle.suffix)
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, subtitle)
+		}
+	}
+
+	for i := range unique {
+		unique[i].Label = unique[i].label()
+	}
+	sort.SliceStable(unique, func(i, j int) bool {
+		if unique[i].Label != unique[j].Label {
+			return unique[i].Label < unique[j].Label
+		}
+		return unique[i].suffix < unique[j].suffix
+	})
+
+	// Same labels (e.g. two unknown languages) are numbered
+	count := make(map[string]int)
+	for i := range unique {
+		count[unique[i].Label]++
+		if n := count[unique[i].Label]; n > 1 {
+			unique[i].Label += fmt.Sprintf(" %d", n)
+		}
+	}
+
+	// Full subtitles in the preferred language, or forced ones when there are none
+	if g.subtitleLang != "" {
+		preferred := -1
+		for i, subtitle := range unique {
+			if !languageMatches(subtitle.Language, g.subtitleLang) {
+				continue
+			}
+			if preferred < 0 || (unique[preferred].forced && !subtitle.forced) {
+				preferred = i
+			}
+		}
+		if preferred >= 0 {
+			unique[preferred].Default = true
+		}
+	}
+	return unique
+}
+
+// label names the track after its language and flags
+// (e.g. "Portuguese (Brazil) (Forced)" or "English SDH")
+func (s Subtitle) label() string {
+	label := "Subtitles"
+	if s.Language != "" {
+		label = languageName(s.Language)
+	}
+	if s.sdh {
+		label += " SDH"
+	}
+	if s.forced {
+		label += " (Forced)"
+	}
+	return label
+}
+
+// languageMatches reports whether tag is the preferred language: the same
+// tag, or the same language when either one has no region (pt and pt-BR)
+func languageMatches(tag, preferred string) bool {
+	if tag == "" {
+		return false
+	}
+	if normalized, ok := parseLanguage(preferred); ok {
+		preferred = normalized
+	}
+	if strings.EqualFold(tag, preferred) {
+		return true
+	}
+	base, region, _ := strings.Cut(tag, "-")
+	preferredBase, preferredRegion, _ := strings.Cut(preferred, "-")
+	return strings.EqualFold(base, preferredBase) && (region == "" || preferredRegion == "")
+}
+
+// SubtitlesText lists the subtitle tracks (e.g. "English, Portuguese (Brazil)")
+func (v *Video) SubtitlesText() string {
+	labels := make([]string, len(v.Subtitles))
+	for i, subtitle := range v.Subtitles {
+		labels[i] = subtitle.Label
+	}
+	return strings.Join(labels, ", ")
+}
+
+// generateSubtitles writes the subtitles of every video as WebVTT, which is
+// the only format browsers read. SRT and ASS files are converted; existing
+// files are reused unless the sidecar is newer. Tracks that can't be read
+// are dropped with a warning.
+func (g *Generator) generateSubtitles() error {
+	dir := filepath.Join(g.outputDir, subtitleDir)
+	keep := make(map[string]bool)
+	converted := 0
+
+	for _, video := range g.videos {
+		if len(video.Subtitles) == 0 {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+
+		var subtitles []Subtitle
+		for _, subtitle := range video.Subtitles {
+			fileName := fileSlug(video.RelativePath)
+			if subtitle.suffix != "" {
+				fileName += "." + sanitizeFileName(strings.ReplaceAll(subtitle.suffix, ".", "_"))
+			}
+			fileName += ".vtt"
+			vttPath := filepath.Join(dir, fileName)
+			keep[fileName] = true
+
+			if info, err := os.Stat(vttPath); err != nil || info.ModTime().Before(subtitle.modTime) {
+				if err := writeWebVTT(filepath.Join(g.rootDir, subtitle.source), vttPath); err != nil {
+					fmt.Printf("  Warning: Error converting subtitles %s: %v\n", filepath.Base(subtitle.source), err)
+					continue
+				}
+				converted++
+			}
+
+			subtitle.Src = subtitleDir + "/" + fileName
+			subtitles = append(subtitles, subtitle)
+		}
+		video.Subtitles = subtitles
+	}
+
+	if converted > 0 {
+		fmt.Printf("Converted %d subtitles to WebVTT\n", converted)
+	}
+
+	_, err := pruneFiles(dir, subtitlePatterns, keep)
+	return err
+}
+
+// writeWebVTT converts a subtitle file to WebVTT at vttPath
+func writeWebVTT(srcPath, vttPath string) error {
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		return err
+	}
+	text := decodeSubtitleText(data)
+
+	var vtt []byte
+	switch strings.ToLower(filepath.Ext(srcPath)) {
+	case ".vtt":
+		if !strings.HasPrefix(text, "WEBVTT") {
+			return fmt.Errorf("not a WebVTT file")
+		}
+		vtt = []byte(text)
+	case ".srt":
+		vtt, err = srtToWebVTT(text)
+	default:
+		vtt, err = assToWebVTT(text)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(vttPath, vtt, 0644)
+}
+
+// Subtitle codecs ffmpeg can convert to WebVTT. Others (PGS, VobSub, DVB)
+// are images.
+var textSubtitleCodecs = map[string]bool{
+	"subrip":   true,
+	"ass":      true,
+	"ssa":      true,
+	"webvtt":   true,
+	"mov_text": true,
+	"text":     true,
+}
+
+// extractSubtitles exports subtitle streams of src as WebVTT sidecars named
+// after base and the stream language (base.en.vtt, base.pt-BR.forced.vtt),
+// which the player then offers like any other sidecar. Sidecars that
+// already exist are left alone. It returns the files created.
+func extractSubtitles(r Runner, src, base string, streams []*probeStream) ([]string, error) {
+	args := []string{"-hide_banner", "-loglevel", "error", "-i", src}
+	var created []string
+	used := make(map[string]bool)
+	for _, stream := range streams {
+		path := base + subtitleSidecarSuffix(stream, used) + ".vtt"
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		args = append(args, "-map", fmt.Sprintf("0:%d", stream.Index), "-c:s", "webvtt", "-f", "webvtt", "-n", path)
+		created = append(created, path)
+	}
+	if len(created) == 0 {
+		return nil, nil
+	}
+
+	output, err := r.Command(context.Background(), "ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		for _, path := range created {
+			os.Remove(path)
+		}
+		if lines := lastLines(string(output), 1); len(lines) > 0 {
+			return nil, fmt.Errorf("%v: %s", err, lines[0])
+		}
+		return nil, err
+	}
+	return created, nil
+}
+
+// subtitleSidecarSuffix names the sidecar of a subtitle stream after its
+// language and disposition (".en", ".pt-BR.forced", ".en.sdh"), numbering
+// streams that would get the same name. used tracks the names taken.
+func subtitleSidecarSuffix(stream *probeStream, used map[string]bool) string {
+	var parts []string
+	if tag, ok := parseLanguage(stream.Tags["language"]); ok {
+		parts = append(parts, tag)
+	}
+	if stream.Disposition["forced"] == 1 {
+		parts = append(parts, "forced")
+	}
+	if stream.Disposition["hearing_impaired"] == 1 {
+		parts = append(parts, "sdh")
+	}
+
+	suffix := ""
+	if len(parts) > 0 {
+		suffix = "." + strings.Join(parts, ".")
+	}
+	name := suffix
+	for n := 2; used[name]; n++ {
+		name = fmt.Sprintf("%s.%d", suffix, n)
+	}
+	used[name] = true
+	return name
+}
+
+// describeSubtitleStream describes a subtitle stream for reports
+// (e.g. "stream 3, PGS, eng")
+func describeSubtitleStream(stream *probeStream) string {
+	parts := []string{fmt.Sprintf("stream %d", stream.Index), codecDisplayName(stream.CodecName)}
+	if language := stream.Tags["language"]; language != "" {
+		parts = append(parts, language)
+	}
+	if title := stream.Tags["title"]; title != "" {
+		parts = append(parts, title)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,112 @@
+package generator
+
+import (
+	"testing"
+)
+
+func TestParseSubtitleName(t *testing.T) {
+	tests := []struct {
+		file     string // Sidecar of movie.mp4
+		language string
+		forced   bool
+		sdh      bool
+	}{
+		{"movie.srt", "", false, false},
+		{"movie.en.srt", "en", false, false},
+		{"movie.eng.srt", "en", false, false},
+		{"movie.pt-BR.srt", "pt-BR", false, false},
+		{"movie.pt_br.srt", "pt-BR", false, false},
+		{"movie.es-419.srt", "es-419", false, false},
+		{"movie.forced.srt", "", true, false},
+		{"movie.pt-BR.forced.srt", "pt-BR", true, false},
+		{"movie.eng.sdh.srt", "en", false, true},
+		{"movie.en.cc.srt", "en", false, true},
+		{"movie.FORCED.fre.srt", "fr", true, false},
+		{"movie.fr.en.srt", "fr", false, false},
+		{"movie.und.srt", "", false, false},
+		{"movie.commentary.srt", "", false, false},
+	}
+
+	for _, tt := range tests {
+		name := tt.file[len("movie") : len(tt.file)-len(".srt")]
+		if name != "" {
+			name = name[1:]
+		}
+		got := parseSubtitleName(name)
+		if got.Language != tt.language || got.forced != tt.forced || got.sdh != tt.sdh {
+			t.Errorf("%s: language %q, forced %v, sdh %v; want %q, %v, %v",
+				tt.file, got.Language, got.forced, got.sdh, tt.language, tt.forced, tt.sdh)
+		}
+	}
+}
+
+func TestSubtitleLabel(t *testing.T) {
+	tests := []struct {
+		suffix string
+		want   string
+	}{
+		{"", "Subtitles"},
+		{"en", "English"},
+		{"pt-BR", "Portuguese (Brazil)"},
+		{"pt-BR.forced", "Portuguese (Brazil) (Forced)"},
+		{"eng.sdh", "English SDH"},
+		{"forced", "Subtitles (Forced)"},
+		{"zh-Hant", "Chinese (Hant)"},
+	}
+
+	for _, tt := range tests {
+		if got := parseSubtitleName(tt.suffix).label(); got != tt.want {
+			t.Errorf("label of %q = %q, want %q", tt.suffix, got, tt.want)
+		}
+	}
+}
+
+func TestLanguageMatches(t *testing.T) {
+	tests := []struct {
+		tag, preferred string
+		want           bool
+	}{
+		{"en", "en", true},
+		{"en", "eng", true},
+		{"pt-BR", "pt-BR", true},
+		{"pt-BR", "pt-br", true},
+		{"pt-BR", "pt", true},
+		{"pt", "pt-BR", true},
+		{"pt-PT", "pt-BR", false},
+		{"en", "fr", false},
+		{"", "en", false},
+	}
+
+	for _, tt := range tests {
+		if got := languageMatches(tt.tag, tt.preferred); got != tt.want {
+			t.Errorf("languageMatches(%q, %q) = %v, want %v", tt.tag, tt.preferred, got, tt.want)
+		}
+	}
+}
+
+func TestParseLanguage(t *testing.T) {
+	tests := []struct {
+		code string
+		tag  string
+		ok   bool
+	}{
+		{"en", "en", true},
+		{"ENG", "en", true},
+		{"ger", "de", true},
+		{"deu", "de", true},
+		{"pt-br", "pt-BR", true},
+		{"pt_BR", "pt-BR", true},
+		{"es-419", "es-419", true},
+		{"zh-hant", "zh-Hant", true},
+		{"und", "", false},
+		{"xx", "", false},
+		{"english", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		if tag, ok := parseLanguage(tt.code); tag != tt.tag || ok != tt.ok {
+			t.Errorf("parseLanguage(%q) = %q, %v; want %q, %v", tt.code, tag, ok, tt.tag, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Directory (relative to output) where thumbnails are stored
+const thumbnailDir = ".vsite/thumbnails"
+
+// Generated files in thumbnailDir, besides the previews
+var thumbnailPatterns = []string{"*.jpg"}
+
+// Thumbnail width in pixels (height keeps the aspect ratio)
+const thumbnailWidth = 480
+
+// Seek offsets (in seconds) tried when grabbing a thumbnail frame of a video
+// with unknown duration. The first one skips intros and fade-ins; the last
+// one covers short clips.
+var defaultThumbnailOffsets = []string{"10", "0"}
+
+// generateThumbnails extracts a representative frame for each video.
+// Existing thumbnails are reused unless the source file is newer.
+// If ffmpeg is not installed, videos keep the placeholder thumbnail.
+func (g *Generator) generateThumbnails() error {
+	if _, err := g.runner.LookPath("ffmpeg"); err != nil {
+		fmt.Println("ffmpeg not found, using placeholder thumbnails")
+		return nil
+	}
+
+	dir := filepath.Join(g.outputDir, thumbnailDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	created := 0
+	keep := make(map[string]bool)
+	for _, video := range g.videos {
+		fileName := fileSlug(video.RelativePath) + ".jpg"
+		thumbPath := filepath.Join(dir, fileName)
+		keep[fileName] = true
+
+		if !thumbnailUpToDate(thumbPath, video) {
+			fmt.Printf("Generating thumbnail: %s\n", video.FileName)
+			srcPath := filepath.Join(g.rootDir, video.RelativePath)
+			if err := extractThumbnail(g.runner, srcPath, thumbPath, thumbnailOffsets(video)); err != nil {
+				fmt.Printf("  Warning: Error generating thumbnail for %s: %v\n", video.FileName, err)
+				continue
+			}
+			created++
+		}
+
+		video.Thumbnail = thumbnailDir + "/" + fileName
+	}
+
+	if created > 0 {
+		fmt.Printf("Generated %d thumbnails\n", created)
+	}
+
+	_, err := pruneFiles(dir, thumbnailPatterns, keep)
+	return err
+}
+
+// thumbnailUpToDate reports whether the thumbnail exists and is not older than the video
+func thumbnailUpToDate(thumbPath string, video *Video) bool {
+	info, err := os.Stat(thumbPath)
+	if err != nil || info.Size() == 0 {
+		return false
+	}
+	return !info.ModTime().Before(video.modTime)
+}
+
+// thumbnailOffsets returns the seek offsets to try for a video,
+// starting at 10% of its duration when known
+func thumbnailOffsets(video *Video) []string {
+	if video.Duration <= 0 {
+		return defaultThumbnailOffsets
+	}
+	return []string{strconv.FormatFloat(video.Duration/10, 'f', 3, 64), "0"}
+}
+
+// extractThumbnail grabs a single scaled frame from srcPath into thumbPath
+func extractThumbnail(r Runner, srcPath, thumbPath string, offsets []string) error {
+	var lastErr error
+	for _, offset := range offsets {
+		// Drop any stale thumbnail so a successful run is detectable
+		os.Remove(thumbPath)
+
+		cmd := r.Command(context.Background(), "ffmpeg",
+			"-hide_banner",
+			"-loglevel", "error",
+			"-ss", offset,
+			"-i", srcPath,
+			"-vf", fmt.Sprintf("thumbnail,scale=%d:-2", thumbnailWidth),
+			"-frames:v", "1",
+			"-y",
+			thumbPath,
+		)
+		output, err := cmd.CombinedOutput()
+		if err == nil {
+			// Seeking past the end succeeds without writing a frame
+			if info, statErr := os.Stat(thumbPath); statErr == nil && info.Size() > 0 {
+				return nil
+			}
+			lastErr = fmt.Errorf("no frame extracted")
+			continue
+		}
+		lastErr = fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	// Remove partial file if exists
+	os.Remove(thumbPath)
+	return lastErr
+}
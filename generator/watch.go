@@ -0,0 +1,362 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// How often the library is checked for changes
+const watchInterval = 2 * time.Second
+
+// How often the whole library is scanned, to catch files modified in place.
+// Other checks only re-read the directories whose modification time changed.
+const watchFullScanInterval = time.Minute
+
+// How long the library must stay unchanged before regenerating, so bursts
+// of changes (copies, renames, moves) are handled in a single pass
+const watchSettleDelay = 3 * time.Second
+
+// fileState identifies a version of a file
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// librarySnapshot maps relative paths of video and subtitle files to their state
+type librarySnapshot map[string]fileState
+
+// Watch keeps running, regenerating the site whenever videos or subtitles
+// are added, removed, renamed or modified under the root directory. onChange, if not
+// nil, is called with the affected pages after each regeneration.
+// Generation is incremental: only new or changed videos are processed, and
+// only the pages they affect are written.
+func (g *Generator) Watch(onChange func(PageChanges)) error {
+	fmt.Printf("Watching %s for changes (Ctrl+C to stop)...\n", g.rootDir)
+
+	scanner := &libraryScanner{g: g}
+	prev, err := scanner.full()
+	if err != nil {
+		return err
+	}
+	lastFull := time.Now()
+
+	for {
+		time.Sleep(watchInterval)
+
+		scan := scanner.quick
+		if time.Since(lastFull) >= watchFullScanInterval {
+			scan = scanner.full
+			lastFull = time.Now()
+		}
+
+		current, err := scan()
+		if err != nil {
+			fmt.Printf("Warning: Error scanning %s: %v\n", g.rootDir, err)
+			lastFull = time.Time{}
+			continue
+		}
+		if current.equal(prev) {
+			continue
+		}
+
+		// Wait for the changes to settle (e.g. large files still being copied,
+		// which only changes their size)
+		for {
+			time.Sleep(watchSettleDelay)
+			next, err := scanner.full()
+			if err != nil {
+				fmt.Printf("Warning: Error scanning %s: %v\n", g.rootDir, err)
+				continue
+			}
+			if next.equal(current) {
+				break
+			}
+			current = next
+		}
+		lastFull = time.Now()
+
+		added, removed, modified := prev.diff(current)
+		fmt.Printf("\nChanges detected: %d added, %d removed, %d modified\n", len(added), len(removed), len(modified))
+		prev = current
+
+		if err := g.generate(slices.Concat(added, removed, modified)); err != nil {
+			fmt.Printf("Error generating HTML: %v\n", err)
+			continue
+		}
+
+		if onChange != nil {
+			onChange(g.Changes())
+		}
+	}
+}
+
+// libraryScanner snapshots the library, keeping the modification time of
+// every directory so later scans only re-read the directories that changed
+type libraryScanner struct {
+	g     *Generator
+	dirs  map[string]time.Time // Relative directory path -> modification time
+	files librarySnapshot
+}
+
+// full records the state of every video and subtitle file under the root
+func (s *libraryScanner) full() (librarySnapshot, error) {
+	s.dirs = make(map[string]time.Time)
+	s.files = make(librarySnapshot)
+	if err := s.scanTree("."); err != nil {
+		return nil, err
+	}
+	return maps.Clone(s.files), nil
+}
+
+// quick updates the previous scan by re-reading only the directories whose
+// modification time changed, and the new directories found in them. Files
+// modified in place, which doesn't change their directory, are missed.
+func (s *libraryScanner) quick() (librarySnapshot, error) {
+	if s.dirs == nil {
+		return s.full()
+	}
+
+	var changed []string
+	for relDir, modTime := range s.dirs {
+		info, err := os.Stat(filepath.Join(s.g.rootDir, relDir))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			delete(s.dirs, relDir)
+			s.removeFiles(relDir)
+		case err != nil:
+			return nil, err
+		case !info.ModTime().Equal(modTime):
+			changed = append(changed, relDir)
+		}
+	}
+
+	for _, relDir := range changed {
+		if err := s.scanDir(relDir); err != nil {
+			return nil, err
+		}
+	}
+	return maps.Clone(s.files), nil
+}
+
+// scanTree records relDir and every directory, video and subtitle file below it
+func (s *libraryScanner) scanTree(relDir string) error {
+	excluded := s.g.excludedDir()
+
+	return filepath.WalkDir(filepath.Join(s.g.rootDir, relDir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(s.g.rootDir, path)
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if relPath != "." && s.skipDir(path, excluded) {
+				return filepath.SkipDir
+			}
+			info, err := d.Info()
+			if err != nil {
+				// Directory removed while walking
+				return filepath.SkipDir
+			}
+			s.dirs[relPath] = info.ModTime()
+			return nil
+		}
+
+		s.addFile(relPath, d)
+		return nil
+	})
+}
+
+// scanDir re-reads the files directly in relDir, and scans the directories
+// created in it since the last scan
+func (s *libraryScanner) scanDir(relDir string) error {
+	dir := filepath.Join(s.g.rootDir, relDir)
+
+	// The modification time is read first so changes made while reading are
+	// caught by the next scan
+	info, err := os.Stat(dir)
+	var entries []os.DirEntry
+	if err == nil {
+		entries, err = os.ReadDir(dir)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		// Removed since it was checked; its subdirectories are removed by the next scan
+		delete(s.dirs, relDir)
+		s.removeFiles(relDir)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.dirs[relDir] = info.ModTime()
+	s.removeFiles(relDir)
+
+	excluded := s.g.excludedDir()
+	for _, entry := range entries {
+		relPath := filepath.Join(relDir, entry.Name())
+		if !entry.IsDir() {
+			s.addFile(relPath, entry)
+			continue
+		}
+		if _, known := s.dirs[relPath]; known || s.skipDir(filepath.Join(dir, entry.Name()), excluded) {
+			continue
+		}
+		if err := s.scanTree(relPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipDir reports whether the directory at path is left out of the library:
+// hidden directories and the output directory
+func (s *libraryScanner) skipDir(path, excluded string) bool {
+	return strings.HasPrefix(filepath.Base(path), ".") || isDir(path, excluded)
+}
+
+// addFile records the state of the file at relPath if it's a video or a subtitle
+func (s *libraryScanner) addFile(relPath string, d fs.DirEntry) {
+	// Hidden files, such as in-progress conversions, aren't part of the library
+	if strings.HasPrefix(d.Name(), ".") {
+		return
+	}
+
+	if ext := strings.ToLower(filepath.Ext(relPath)); !videoExtensions[ext] && !subtitleExtensions[ext] {
+		return
+	}
+
+	info, err := d.Info()
+	if err != nil {
+		// File removed while scanning
+		return
+	}
+	s.files[relPath] = fileState{size: info.Size(), modTime: info.ModTime()}
+}
+
+// removeFiles forgets the files directly in relDir
+func (s *libraryScanner) removeFiles(relDir string) {
+	maps.DeleteFunc(s.files, func(relPath string, _ fileState) bool {
+		return filepath.Dir(relPath) == relDir
+	})
+}
+
+// equal reports whether both snapshots contain the same files in the same state
+func (s librarySnapshot) equal(other librarySnapshot) bool {
+	if len(s) != len(other) {
+		return false
+	}
+	for path, state := range s {
+		if otherState, ok := other[path]; !ok || otherState.size != state.size || !otherState.modTime.Equal(state.modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// diff lists the files added, removed and modified from s to other.
+// A rename counts as one removal and one addition.
+func (s librarySnapshot) diff(other librarySnapshot) (added, removed, modified []string) {
+	for path, state := range other {
+		oldState, ok := s[path]
+		switch {
+		case !ok:
+			added = append(added, path)
+		case oldState.size != state.size || !oldState.modTime.Equal(state.modTime):
+			modified = append(modified, path)
+		}
+	}
+	for path := range s {
+		if _, ok := other[path]; !ok {
+			removed = append(removed, path)
+		}
+	}
+	return added, removed, modified
+}
+
+// affectedPages lists the pages regenerated after a change
+type affectedPages struct {
+	dirs   map[string]bool // Directories whose index is regenerated ("" for the root)
+	videos map[string]bool // Videos (relative paths) whose player page is regenerated
+}
+
+// dir reports whether the index page of dir is regenerated (all of them when a is nil)
+func (a *affectedPages) dir(dir string) bool {
+	return a == nil || a.dirs[dir]
+}
+
+// video reports whether the player page of the video at relPath is
+// regenerated (all of them when a is nil)
+func (a *affectedPages) video(relPath string) bool {
+	return a == nil || a.videos[relPath]
+}
+
+// findAffectedPages returns the pages affected by changes to files: the
+// index of their directory and of the directories above it (which list
+// it), the player page of their video and those of the videos next to it,
+// which link to it. Videos are looked up both in the previous directory
+// tree and in the current one, so the neighbors of removed videos are
+// included.
+func (g *Generator) findAffectedPages(changed []string, previous map[string][]*Video) *affectedPages {
+	affected := &affectedPages{dirs: make(map[string]bool), videos: make(map[string]bool)}
+
+	for _, relPath := range changed {
+		dir := filepath.Dir(relPath)
+		if dir == "." {
+			dir = ""
+		}
+
+		for _, tree := range []map[string][]*Video{previous, g.dirTree} {
+			videos := tree[dir]
+			for i, video := range videos {
+				if !video.hasFile(relPath) {
+					continue
+				}
+				for _, neighbor := range videos[max(0, i-1):min(len(videos), i+2)] {
+					affected.videos[neighbor.RelativePath] = true
+				}
+			}
+		}
+
+		for {
+			affected.dirs[dir] = true
+			if dir == "" {
+				break
+			}
+			if dir = filepath.Dir(dir); dir == "." {
+				dir = ""
+			}
+		}
+	}
+
+	return affected
+}
+
+// hasFile reports whether relPath is a file of the video: the video
+// itself, another encoding or a subtitle sidecar
+func (v *Video) hasFile(relPath string) bool {
+	if v.RelativePath == relPath {
+		return true
+	}
+	for _, encoding := range v.encodings {
+		if encoding.RelativePath == relPath {
+			return true
+		}
+	}
+	for _, subtitle := range v.Subtitles {
+		if subtitle.source == relPath {
+			return true
+		}
+	}
+	return false
+}
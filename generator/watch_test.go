@@ -0,0 +1,185 @@
+package generator
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSnapshotDiff(t *testing.T) {
+	now := time.Now()
+	prev := librarySnapshot{
+		"a.mp4":      {size: 1, modTime: now},
+		"b.mp4":      {size: 1, modTime: now},
+		"c.mp4":      {size: 1, modTime: now},
+		"old.en.srt": {size: 1, modTime: now},
+	}
+	current := librarySnapshot{
+		"a.mp4":      {size: 1, modTime: now},
+		"b.mp4":      {size: 2, modTime: now},
+		"c.mp4":      {size: 1, modTime: now.Add(time.Second)},
+		"new.en.srt": {size: 1, modTime: now},
+	}
+
+	added, removed, modified := prev.diff(current)
+	slices.Sort(modified)
+	if !slices.Equal(added, []string{"new.en.srt"}) || !slices.Equal(removed, []string{"old.en.srt"}) ||
+		!slices.Equal(modified, []string{"b.mp4", "c.mp4"}) {
+		t.Errorf("diff() = %q, %q, %q; want [new.en.srt], [old.en.srt], [b.mp4 c.mp4]", added, removed, modified)
+	}
+}
+
+func TestLibraryScannerQuick(t *testing.T) {
+	root := t.TempDir()
+	write := func(relPath string) {
+		t.Helper()
+		path := filepath.Join(root, relPath)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("video"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// touch moves the modification time of a directory forward, as filesystems
+	// with coarse timestamps may not change it between quick edits
+	touch := func(relDir string) {
+		t.Helper()
+		later := time.Now().Add(time.Minute)
+		if err := os.Chtimes(filepath.Join(root, relDir), later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("top.mp4")
+	write(filepath.Join("movies", "a.mp4"))
+	write(filepath.Join("shows", "s1", "e1.mkv"))
+	write(filepath.Join("old", "x.mp4"))
+
+	g := New(root)
+	scanner := &libraryScanner{g: g}
+	if _, err := scanner.full(); err != nil {
+		t.Fatalf("full() = %v", err)
+	}
+
+	write(filepath.Join("movies", "b.mp4"))
+	write(filepath.Join("movies", ".b.converting.mp4"))
+	touch("movies")
+	write(filepath.Join("shows", "s2", "e1.mkv"))
+	touch("shows")
+	if err := os.RemoveAll(filepath.Join(root, "old")); err != nil {
+		t.Fatal(err)
+	}
+	touch(".")
+
+	quick, err := scanner.quick()
+	if err != nil {
+		t.Fatalf("quick() = %v", err)
+	}
+	full, err := (&libraryScanner{g: g}).full()
+	if err != nil {
+		t.Fatalf("full() = %v", err)
+	}
+	want := []string{"movies/a.mp4", "movies/b.mp4", "shows/s1/e1.mkv", "shows/s2/e1.mkv", "top.mp4"}
+	for i := range want {
+		want[i] = filepath.FromSlash(want[i])
+	}
+	if got := slices.Sorted(maps.Keys(quick)); !slices.Equal(got, want) {
+		t.Errorf("quick() = %q, want %q", got, want)
+	}
+	if !quick.equal(full) {
+		t.Errorf("quick() = %v, want the same as full() %v", quick, full)
+	}
+}
+
+func TestFindAffectedPages(t *testing.T) {
+	video := func(relPath string) *Video {
+		dir := filepath.Dir(relPath)
+		if dir == "." {
+			dir = ""
+		}
+		return &Video{RelativePath: relPath, Directory: dir}
+	}
+	tree := func(videos ...*Video) map[string][]*Video {
+		dirTree := make(map[string][]*Video)
+		for _, v := range videos {
+			dirTree[v.Directory] = append(dirTree[v.Directory], v)
+		}
+		return dirTree
+	}
+
+	movie := video(filepath.Join("movies", "b.mp4"))
+	movie.encodings = []*Video{video(filepath.Join("movies", "b.webm"))}
+	movie.Subtitles = []Subtitle{{source: filepath.Join("movies", "b.pt-BR.srt")}}
+	current := tree(
+		video("top.mp4"),
+		video(filepath.Join("movies", "a.mp4")), movie, video(filepath.Join("movies", "c.mp4")), video(filepath.Join("movies", "d.mp4")),
+		video(filepath.Join("movies", "old", "x.mp4")), video(filepath.Join("movies", "old", "z.mp4")),
+	)
+	// y.mp4 was between x.mp4 and z.mp4 before it was removed
+	previous := tree(
+		video("top.mp4"),
+		video(filepath.Join("movies", "a.mp4")), movie, video(filepath.Join("movies", "c.mp4")), video(filepath.Join("movies", "d.mp4")),
+		video(filepath.Join("movies", "old", "x.mp4")), video(filepath.Join("movies", "old", "y.mp4")), video(filepath.Join("movies", "old", "z.mp4")),
+	)
+
+	tests := []struct {
+		name    string
+		changed []string
+		dirs    []string
+		videos  []string
+	}{
+		{
+			name:    "video",
+			changed: []string{filepath.Join("movies", "c.mp4")},
+			dirs:    []string{"", "movies"},
+			videos:  []string{filepath.Join("movies", "b.mp4"), filepath.Join("movies", "c.mp4"), filepath.Join("movies", "d.mp4")},
+		},
+		{
+			name:    "other encoding",
+			changed: []string{filepath.Join("movies", "b.webm")},
+			dirs:    []string{"", "movies"},
+			videos:  []string{filepath.Join("movies", "a.mp4"), filepath.Join("movies", "b.mp4"), filepath.Join("movies", "c.mp4")},
+		},
+		{
+			name:    "subtitle",
+			changed: []string{filepath.Join("movies", "b.pt-BR.srt")},
+			dirs:    []string{"", "movies"},
+			videos:  []string{filepath.Join("movies", "a.mp4"), filepath.Join("movies", "b.mp4"), filepath.Join("movies", "c.mp4")},
+		},
+		{
+			name:    "removed video",
+			changed: []string{filepath.Join("movies", "old", "y.mp4")},
+			dirs:    []string{"", "movies", filepath.Join("movies", "old")},
+			videos:  []string{filepath.Join("movies", "old", "x.mp4"), filepath.Join("movies", "old", "y.mp4"), filepath.Join("movies", "old", "z.mp4")},
+		},
+		{
+			name:    "root",
+			changed: []string{"top.mp4"},
+			dirs:    []string{""},
+			videos:  []string{"top.mp4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Generator{dirTree: current}
+			affected := g.findAffectedPages(tt.changed, previous)
+
+			if dirs := slices.Sorted(maps.Keys(affected.dirs)); !slices.Equal(dirs, tt.dirs) {
+				t.Errorf("dirs = %q, want %q", dirs, tt.dirs)
+			}
+			if videos := slices.Sorted(maps.Keys(affected.videos)); !slices.Equal(videos, tt.videos) {
+				t.Errorf("videos = %q, want %q", videos, tt.videos)
+			}
+		})
+	}
+
+	var all *affectedPages
+	if !all.dir("movies") || !all.video("top.mp4") {
+		t.Error("nil affectedPages should include every page")
+	}
+}
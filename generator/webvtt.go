@@ -0,0 +1,242 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// SRT timing line (00:01:02,500 --> 00:01:04,000). Hours, seconds and
+// milliseconds are often written with fewer digits, or a dot.
+var srtTiming = regexp.MustCompile(`^\s*(\d+):(\d{1,2}):(\d{1,2})[,.](\d{1,3})\s*-->\s*(\d+):(\d{1,2}):(\d{1,2})[,.](\d{1,3})`)
+
+// Override blocks ({\an8}, {\i1}, ...) used by ASS and by some SRT files
+var overrideTags = regexp.MustCompile(`\{\\[^}]*\}`)
+
+// SRT formatting tags WebVTT doesn't have (<font color="...">)
+var fontTags = regexp.MustCompile(`(?i)</?font[^>]*>`)
+
+// Markup kept in cue text: bold, italic and underline tags, and common
+// character references. Any other "&", "<" or ">" is escaped.
+var cueMarkup = regexp.MustCompile(`(?i)</?[biu]>|&(?:amp|lt|gt|quot|apos|nbsp|lrm|rlm|#[0-9]+|#x[0-9a-f]+);`)
+
+// Windows-1252 characters in the 0x80-0x9F range (undefined bytes map to
+// themselves, as in Latin-1)
+var cp1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8D, 'Ž', 0x8F,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9D, 'ž', 'Ÿ',
+}
+
+// webvttCue is a subtitle shown between start and end
+type webvttCue struct {
+	start, end time.Duration
+	text       string
+}
+
+// decodeSubtitleText returns the text of a subtitle file as UTF-8. Files
+// with a UTF-16 byte order mark are decoded as such; other files that aren't
+// valid UTF-8 are taken as Windows-1252, which most older SRT files use.
+func decodeSubtitleText(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		data = data[3:]
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}), bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		bigEndian := data[0] == 0xFE
+		units := make([]uint16, 0, len(data)/2)
+		for i := 2; i+1 < len(data); i += 2 {
+			if bigEndian {
+				units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+			} else {
+				units = append(units, uint16(data[i+1])<<8|uint16(data[i]))
+			}
+		}
+		data = []byte(string(utf16.Decode(units)))
+	}
+
+	if !utf8.Valid(data) {
+		var text strings.Builder
+		for _, b := range data {
+			if b >= 0x80 && b < 0xA0 {
+				text.WriteRune(cp1252[b-0x80])
+			} else {
+				text.WriteRune(rune(b))
+			}
+		}
+		data = []byte(text.String())
+	}
+
+	return strings.ReplaceAll(string(data), "\r\n", "\n")
+}
+
+// srtToWebVTT converts SubRip subtitles to WebVTT
+func srtToWebVTT(text string) ([]byte, error) {
+	var cues []webvttCue
+	// Windows (CRLF) and old Mac (CR) line endings
+	text = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(text)
+	for _, block := range strings.Split(text, "\n\n") {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+
+		// The timing line follows the (optional) cue number
+		timing := -1
+		for i, line := range lines[:min(2, len(lines))] {
+			if srtTiming.MatchString(line) {
+				timing = i
+				break
+			}
+		}
+		if timing < 0 {
+			continue
+		}
+
+		m := srtTiming.FindStringSubmatch(lines[timing])
+		cue := webvttCue{
+			start: parseTimestamp(m[1], m[2], m[3], m[4]),
+			end:   parseTimestamp(m[5], m[6], m[7], m[8]),
+			text:  strings.Join(lines[timing+1:], "\n"),
+		}
+		cue.text = fontTags.ReplaceAllString(overrideTags.ReplaceAllString(cue.text, ""), "")
+		cues = append(cues, cue)
+	}
+
+	if len(cues) == 0 {
+		return nil, fmt.Errorf("no subtitles found")
+	}
+	return formatWebVTT(cues), nil
+}
+
+// assToWebVTT converts the dialogue of SubStation Alpha (ASS/SSA)
+// subtitles to WebVTT. Styles and positioning are dropped.
+func assToWebVTT(text string) ([]byte, error) {
+	var cues []webvttCue
+	var format []string
+	inEvents := false
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			inEvents = strings.EqualFold(line, "[Events]")
+			continue
+		}
+		if !inEvents {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Format":
+			format = nil
+			for _, field := range strings.Split(value, ",") {
+				format = append(format, strings.ToLower(strings.TrimSpace(field)))
+			}
+		case "Dialogue":
+			// The text is the last field and may contain commas
+			fields := strings.SplitN(value, ",", len(format))
+			if len(format) == 0 || len(fields) != len(format) {
+				continue
+			}
+			startField, endField := slices.Index(format, "start"), slices.Index(format, "end")
+			if startField < 0 || endField < 0 {
+				continue
+			}
+			start, errStart := parseASSTime(fields[startField])
+			end, errEnd := parseASSTime(fields[endField])
+			if errStart != nil || errEnd != nil {
+				continue
+			}
+
+			dialogue := fields[len(fields)-1]
+			if strings.Contains(dialogue, `\p1`) {
+				// Vector drawing, not text
+				continue
+			}
+			dialogue = overrideTags.ReplaceAllString(dialogue, "")
+			dialogue = strings.NewReplacer(`\N`, "\n", `\n`, "\n", `\h`, " ").Replace(dialogue)
+			if strings.TrimSpace(dialogue) == "" {
+				continue
+			}
+			cues = append(cues, webvttCue{start: start, end: end, text: dialogue})
+		}
+	}
+
+	if len(cues) == 0 {
+		return nil, fmt.Errorf("no dialogue found")
+	}
+	// Events may be in any order; cues must be sorted by start time
+	slices.SortStableFunc(cues, func(a, b webvttCue) int { return int(a.start - b.start) })
+	return formatWebVTT(cues), nil
+}
+
+// parseTimestamp builds a duration from hours, minutes, seconds and a
+// fraction of a second given with up to 3 digits
+func parseTimestamp(hours, minutes, seconds, fraction string) time.Duration {
+	h, _ := strconv.Atoi(hours)
+	m, _ := strconv.Atoi(minutes)
+	s, _ := strconv.Atoi(seconds)
+	ms, _ := strconv.Atoi((fraction + "00")[:3])
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute +
+		time.Duration(s)*time.Second + time.Duration(ms)*time.Millisecond
+}
+
+// parseASSTime parses an ASS timestamp (H:MM:SS.cc)
+func parseASSTime(value string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid time '%s'", value)
+	}
+	seconds, fraction, _ := strings.Cut(parts[2], ".")
+	return parseTimestamp(parts[0], parts[1], seconds, fraction), nil
+}
+
+// formatWebVTT writes cues as a WebVTT file
+func formatWebVTT(cues []webvttCue) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("WEBVTT\n")
+	for _, cue := range cues {
+		// A blank line or an arrow would end the cue early
+		var lines []string
+		for _, line := range strings.Split(cue.text, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, escapeCueText(line))
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(&buf, "\n%s --> %s\n%s\n", formatVTTTime(cue.start), formatVTTTime(cue.end), strings.Join(lines, "\n"))
+	}
+	return buf.Bytes()
+}
+
+// escapeCueText escapes the characters WebVTT reserves for markup, keeping
+// only <b>, <i> and <u> tags and character references
+func escapeCueText(text string) string {
+	var buf strings.Builder
+	escape := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	last := 0
+	for _, m := range cueMarkup.FindAllStringIndex(text, -1) {
+		buf.WriteString(escape.Replace(text[last:m[0]]))
+		markup := text[m[0]:m[1]]
+		if strings.HasPrefix(markup, "<") {
+			markup = strings.ToLower(markup)
+		}
+		buf.WriteString(markup)
+		last = m[1]
+	}
+	buf.WriteString(escape.Replace(text[last:]))
+	return buf.String()
+}
+
+// formatVTTTime formats a WebVTT timestamp (HH:MM:SS.mmm)
+func formatVTTTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,184 @@
+package generator
+
+import (
+	"testing"
+)
+
+func TestSRTToWebVTT(t *testing.T) {
+	tests := []struct {
+		name string
+		srt  string
+		want string // Empty when the conversion fails
+	}{
+		{
+			name: "comma milliseconds",
+			srt:  "1\n00:00:01,500 --> 00:00:03,000\nHello\n\n2\n00:00:04,250 --> 00:00:05,000\nTwo\nlines\n",
+			want: "WEBVTT\n\n00:00:01.500 --> 00:00:03.000\nHello\n\n00:00:04.250 --> 00:00:05.000\nTwo\nlines\n",
+		},
+		{
+			name: "dot and short milliseconds",
+			srt:  "1\n0:00:01.5 --> 0:00:03.25\nHello\n",
+			want: "WEBVTT\n\n00:00:01.500 --> 00:00:03.250\nHello\n",
+		},
+		{
+			name: "CRLF",
+			srt:  "1\r\n00:00:01,000 --> 00:00:02,000\r\nFirst\r\nline\r\n\r\n2\r\n00:00:03,000 --> 00:00:04,000\r\nSecond\r\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nFirst\nline\n\n00:00:03.000 --> 00:00:04.000\nSecond\n",
+		},
+		{
+			name: "without cue numbers",
+			srt:  "00:00:01,000 --> 00:00:02,000\nHello\n\n00:00:03,000 --> 00:00:04,000\nWorld\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHello\n\n00:00:03.000 --> 00:00:04.000\nWorld\n",
+		},
+		{
+			name: "override and font tags",
+			srt:  "1\n00:00:01,000 --> 00:00:02,000\n{\\an8}<font color=\"#ffff00\">On <i>top</i></font>\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nOn <i>top</i>\n",
+		},
+		{
+			name: "reserved characters",
+			srt:  "1\n00:00:01,000 --> 00:00:02,000\nTom & Jerry <b>3 < 4</b>\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nTom &amp; Jerry <b>3 &lt; 4</b>\n",
+		},
+		{
+			name: "arrow in the text",
+			srt:  "1\n00:00:01,000 --> 00:00:02,000\nThis --> that\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nThis --&gt; that\n",
+		},
+		{
+			name: "no cues",
+			srt:  "Not a subtitle file\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := srtToWebVTT(tt.srt)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("srtToWebVTT() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("srtToWebVTT() = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("srtToWebVTT() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestASSToWebVTT(t *testing.T) {
+	const header = "[Script Info]\nTitle: Test\nScriptType: v4.00+\n\n" +
+		"[V4+ Styles]\nFormat: Name, Fontname, Fontsize\nStyle: Default,Arial,20\n\n" +
+		"[Events]\nFormat: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n"
+
+	tests := []struct {
+		name string
+		ass  string
+		want string // Empty when the conversion fails
+	}{
+		{
+			name: "dialogue",
+			ass:  header + "Dialogue: 0,0:00:01.20,0:00:02.00,Default,,0,0,0,,Hello, world\n",
+			want: "WEBVTT\n\n00:00:01.200 --> 00:00:02.000\nHello, world\n",
+		},
+		{
+			name: "line breaks and hard spaces",
+			ass:  header + "Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,First\\Nsecond\\nthird\\hword\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nFirst\nsecond\nthird\u00a0word\n",
+		},
+		{
+			name: "reserved characters",
+			ass:  header + "Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,Q&A <live>\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nQ&amp;A &lt;live&gt;\n",
+		},
+		{
+			name: "override tags",
+			ass:  header + "Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\\an8}{\\i1}On top{\\i0}\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nOn top\n",
+		},
+		{
+			name: "sorted by start",
+			ass: header +
+				"Dialogue: 0,0:00:05.00,0:00:06.50,Default,,0,0,0,,Later\n" +
+				"Comment: 0,0:00:02.00,0:00:03.00,Default,,0,0,0,,Not shown\n" +
+				"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,Earlier\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nEarlier\n\n00:00:05.000 --> 00:00:06.500\nLater\n",
+		},
+		{
+			name: "CRLF and drawings",
+			ass: "[Events]\r\nFormat: Layer, Start, End, Style, Text\r\n" +
+				"Dialogue: 0,0:00:01.00,0:00:02.00,Default,{\\p1}m 0 0 l 100 0 100 100{\\p0}\r\n" +
+				"Dialogue: 0,0:00:03.00,0:00:04.00,Default,Text\r\n",
+			want: "WEBVTT\n\n00:00:03.000 --> 00:00:04.000\nText\n",
+		},
+		{
+			name: "no events",
+			ass:  "[Script Info]\nTitle: Test\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := assToWebVTT(tt.ass)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("assToWebVTT() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("assToWebVTT() = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("assToWebVTT() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeSubtitleText(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"UTF-8", []byte("Olá, mundo\n"), "Olá, mundo\n"},
+		{"UTF-8 BOM", []byte("\xEF\xBB\xBFOlá\n"), "Olá\n"},
+		{"UTF-16LE BOM", []byte("\xFF\xFEO\x00l\x00\xE1\x00\r\x00\n\x00"), "Olá\n"},
+		{"UTF-16BE BOM", []byte("\xFE\xFF\x00O\x00l\x00\xE1\x00\r\x00\n"), "Olá\n"},
+		{"Windows-1252", []byte("Caf\xE9 \x93quoted\x94 \x80\n"), "Café “quoted” €\n"},
+		{"CRLF", []byte("one\r\ntwo\r\n"), "one\ntwo\n"},
+	}
+
+	for _, tt := range tests {
+		if got := decodeSubtitleText(tt.data); got != tt.want {
+			t.Errorf("decodeSubtitleText(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeCueText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Plain text", "Plain text"},
+		{"Fish & chips", "Fish &amp; chips"},
+		{"x<y and y>z", "x&lt;y and y&gt;z"},
+		{"<i>Italic</i>, <B>bold</B> and <u>underlined</u>", "<i>Italic</i>, <b>bold</b> and <u>underlined</u>"},
+		{"<span>Other</span> <c.yellow>tags</c>", "&lt;span&gt;Other&lt;/span&gt; &lt;c.yellow&gt;tags&lt;/c&gt;"},
+		{"Already &amp; escaped &#233; &#x263A; &nbsp;", "Already &amp; escaped &#233; &#x263A; &nbsp;"},
+		{"AT&T; R&D", "AT&amp;T; R&amp;D"},
+		{"This --> that", "This --&gt; that"},
+	}
+
+	for _, tt := range tests {
+		if got := escapeCueText(tt.text); got != tt.want {
+			t.Errorf("escapeCueText(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -2,10 +2,15 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"vsite/generator"
+	"vsite/server"
 )
 
 // version is set via ldflags at build time (see Makefile)
@@ -17,19 +22,37 @@ func main() {
 		os.Exit(1)
 	}
 
+	if os.Args[1] == "serve" {
+		runServe(os.Args[2:])
+		return
+	}
+
 	args := os.Args[1:]
 	var rootDir string
-	var title string
+	var outputDir string
+	var mediaURL string
 	var cleanMode bool
 	var cleanConvertedMode bool
 	var cleanOriginalMode bool
 	var convertMode bool
-	var useGPU bool
+	var encoder string
+	var gpu bool
+	var format string
+	var watchMode bool
+	var profileName string
+	var site siteOptions
+	jobs := 1
+	stallTimeout := 5 * time.Minute
 
 	// Parse arguments
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
 
+		if next, ok := site.parse(args, i); ok {
+			i = next
+			continue
+		}
+
 		switch arg {
 		case "-h", "--help":
 			printUsage()
@@ -46,14 +69,68 @@ func main() {
 		case "--convert":
 			convertMode = true
 		case "--gpu":
-			useGPU = true
-		case "-t", "--title":
+			gpu = true
+		case "-e", "--encoder":
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "Error: --encoder requires a value.")
+				os.Exit(1)
+			}
+			i++
+			encoder = args[i]
+		case "--format":
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "Error: --format requires a value.")
+				os.Exit(1)
+			}
+			i++
+			format = args[i]
+		case "-w", "--watch":
+			watchMode = true
+		case "-j", "--jobs":
 			if i+1 >= len(args) {
-				fmt.Fprintln(os.Stderr, "Error: --title requires a value.")
+				fmt.Fprintln(os.Stderr, "Error: --jobs requires a value.")
 				os.Exit(1)
 			}
 			i++
-			title = args[i]
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 1 {
+				fmt.Fprintf(os.Stderr, "Error: invalid number of jobs '%s'\n", args[i])
+				os.Exit(1)
+			}
+			jobs = n
+		case "--stall-timeout":
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "Error: --stall-timeout requires a value.")
+				os.Exit(1)
+			}
+			i++
+			d, err := time.ParseDuration(args[i])
+			if err != nil || d < 0 {
+				fmt.Fprintf(os.Stderr, "Error: invalid timeout '%s' (examples: 90s, 10m, 0 to disable)\n", args[i])
+				os.Exit(1)
+			}
+			stallTimeout = d
+		case "--profile":
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "Error: --profile requires a value.")
+				os.Exit(1)
+			}
+			i++
+			profileName = args[i]
+		case "-o", "--output":
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "Error: --output requires a value.")
+				os.Exit(1)
+			}
+			i++
+			outputDir = args[i]
+		case "--media-url":
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "Error: --media-url requires a value.")
+				os.Exit(1)
+			}
+			i++
+			mediaURL = args[i]
 		default:
 			if !strings.HasPrefix(arg, "-") {
 				rootDir = arg
@@ -70,6 +147,15 @@ func main() {
 		os.Exit(1)
 	}
 
+	// --gpu is a shortcut for --encoder nvenc
+	if gpu {
+		if encoder != "" && encoder != "nvenc" {
+			fmt.Fprintf(os.Stderr, "Error: --gpu (NVENC) can't be combined with --encoder %s.\n", encoder)
+			os.Exit(1)
+		}
+		encoder = "nvenc"
+	}
+
 	if err := validateDirectory(rootDir); err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
@@ -77,6 +163,14 @@ func main() {
 
 	gen := generator.New(rootDir)
 
+	// Set output directory and media links
+	if outputDir != "" {
+		gen.SetOutputDir(outputDir)
+	}
+	if mediaURL != "" {
+		gen.SetMediaBaseURL(mediaURL)
+	}
+
 	if cleanMode {
 		count, err := gen.Clean()
 		if err != nil {
@@ -107,25 +201,328 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Project settings (conversion profiles, HLS ladder)
+	var config *generator.Config
+	if convertMode || site.hls {
+		var err error
+		config, err = loadConfig(rootDir, site.configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Convert videos if requested
 	if convertMode {
-		if err := gen.ConvertVideos(useGPU); err != nil {
+		profile, err := config.Profile(profileName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		opts := generator.ConvertOptions{
+			Encoder:       encoder,
+			Format:        format,
+			Jobs:          jobs,
+			StallTimeout:  stallTimeout,
+			Profile:       profile,
+			AudioLanguage: site.audioLang,
+		}
+		if err := gen.ConvertVideos(opts); err != nil {
 			fmt.Fprintf(os.Stderr, "Error converting videos: %v\n", err)
 			os.Exit(1)
 		}
 	}
 
-	// Set custom title
-	if title != "" {
-		gen.SetTitle(title)
+	// Title, HLS, subtitles, audio, chapters and previews
+	if err := site.apply(gen, config); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 
 	if err := gen.Generate(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error generating HTML: %v\n", err)
+		// In watch mode, the library may still be getting its first videos
+		if !watchMode {
+			os.Exit(1)
+		}
+	} else {
+		fmt.Println("Done! HTML files generated successfully.")
+	}
+
+	if watchMode {
+		if err := gen.Watch(nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Error watching directory: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// runServe handles the "serve" subcommand
+func runServe(args []string) {
+	rootDir := "."
+	var outputDir string
+	port := ""
+	bind := ""
+	useHTTPS := false
+	watchMode := false
+	var tlsDir string
+	var site siteOptions
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if next, ok := site.parse(args, i); ok {
+			i = next
+			continue
+		}
+
+		switch arg {
+		case "-h", "--help":
+			printServeUsage()
+			os.Exit(0)
+		case "--https":
+			useHTTPS = true
+		case "-w", "--watch":
+			watchMode = true
+		case "-p", "--port", "-b", "--bind", "-o", "--output", "--tls-dir":
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a value.\n", arg)
+				os.Exit(1)
+			}
+			i++
+			switch arg {
+			case "-p", "--port":
+				port = args[i]
+			case "-b", "--bind":
+				bind = args[i]
+			case "--tls-dir":
+				tlsDir = args[i]
+			default:
+				outputDir = args[i]
+			}
+		default:
+			if !strings.HasPrefix(arg, "-") {
+				rootDir = arg
+			} else {
+				fmt.Fprintf(os.Stderr, "Error: Unknown option '%s'\n", arg)
+				os.Exit(1)
+			}
+		}
+	}
+
+	if err := validateDirectory(rootDir); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
+	if outputDir == "" {
+		outputDir = rootDir
+	}
+
+	// In watch mode, the site is generated (and kept up to date) by the server itself
+	var gen *generator.Generator
+	if watchMode {
+		gen = generator.New(rootDir)
+		gen.SetOutputDir(outputDir)
+		if !sameDirectory(rootDir, outputDir) {
+			gen.SetMediaBaseURL(strings.TrimSuffix(server.MediaPrefix, "/"))
+		}
+		var config *generator.Config
+		if site.hls {
+			var err error
+			config, err = loadConfig(rootDir, site.configPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if err := site.apply(gen, config); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := gen.Generate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating HTML: %v\n", err)
+		}
+		fmt.Println()
+	}
+
+	if err := validateDirectory(outputDir); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	srv, err := server.New(outputDir, rootDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if gen != nil {
+		go func() {
+			if err := gen.Watch(srv.NotifyReload); err != nil {
+				fmt.Fprintf(os.Stderr, "Error watching directory: %v\n", err)
+				os.Exit(1)
+			}
+		}()
+	} else if _, err := os.Stat(filepath.Join(outputDir, "index.html")); err != nil {
+		fmt.Printf("Warning: no index.html in '%s'. Generate the site first with: vsite %s\n", outputDir, rootDir)
+	}
+	if srv.HasSeparateMedia() && gen == nil {
+		fmt.Printf("Videos are served under %s. Generate the site with: --media-url %s\n",
+			server.MediaPrefix, strings.TrimSuffix(server.MediaPrefix, "/"))
+	}
+
+	scheme := "http"
+	if port == "" {
+		port = "8000"
+		if useHTTPS {
+			port = "8443"
+		}
+	}
+
+	var certs *server.Certificates
+	if useHTTPS {
+		scheme = "https"
+		if tlsDir == "" {
+			tlsDir, err = server.DefaultCertDir()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: cannot determine certificate directory (use --tls-dir): %v\n", err)
+				os.Exit(1)
+			}
+		}
+		certs, err = server.EnsureCertificates(tlsDir, server.LocalHosts())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(server.TrustInstructions(certs.CACert, fmt.Sprintf("https://<address>:%s%s", port, server.CAPath)))
+		fmt.Println()
+	}
+
+	fmt.Println("Serving videos with range request support (seeking enabled)")
+	fmt.Printf("  %s://localhost:%s\n", scheme, port)
+	if bind == "" {
+		for _, ip := range server.LocalAddresses() {
+			fmt.Printf("  %s://%s:%s\n", scheme, ip, port)
+		}
+	}
+	fmt.Println("Press Ctrl+C to stop")
+	fmt.Println()
+
+	addr := net.JoinHostPort(bind, port)
+	if useHTTPS {
+		err = srv.ListenAndServeTLS(addr, certs)
+	} else {
+		err = srv.ListenAndServe(addr)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error starting server: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// siteOptions are the generation settings accepted both by vsite and by
+// vsite serve --watch
+type siteOptions struct {
+	title          string
+	configPath     string
+	hls            bool
+	subtitleLang   string
+	audioLang      string
+	chapterSpacing time.Duration
+	previewFormat  string
+}
+
+// parse reads the option at args[i], if it is a site option, and returns
+// the index of its last argument. Missing or invalid values exit.
+func (o *siteOptions) parse(args []string, i int) (int, bool) {
+	arg := args[i]
+	value := func() string {
+		if i+1 >= len(args) {
+			fmt.Fprintf(os.Stderr, "Error: %s requires a value.\n", arg)
+			os.Exit(1)
+		}
+		i++
+		return args[i]
+	}
+
+	switch arg {
+	case "-t", "--title":
+		o.title = value()
+	case "--config":
+		o.configPath = value()
+	case "--hls":
+		o.hls = true
+	case "--subtitle-lang":
+		o.subtitleLang = value()
+	case "--audio-lang":
+		o.audioLang = value()
+	case "--auto-chapters":
+		if o.chapterSpacing == 0 {
+			o.chapterSpacing = generator.DefaultChapterSpacing
+		}
+	case "--chapter-spacing":
+		spacing := value()
+		d, err := time.ParseDuration(spacing)
+		if err != nil || d <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid spacing '%s' (examples: 90s, 10m)\n", spacing)
+			os.Exit(1)
+		}
+		o.chapterSpacing = d
+	case "--previews":
+		if o.previewFormat == "" {
+			o.previewFormat = generator.DefaultPreviewFormat
+		}
+	case "--preview-format":
+		o.previewFormat = value()
+	default:
+		return i, false
+	}
+	return i, true
+}
+
+// apply configures gen with the options. config holds the HLS settings
+// and is only needed with --hls.
+func (o *siteOptions) apply(gen *generator.Generator, config *generator.Config) error {
+	if o.title != "" {
+		gen.SetTitle(o.title)
+	}
+	if o.hls {
+		gen.SetHLS(config.HLS)
+	}
+	if o.subtitleLang != "" {
+		gen.SetSubtitleLanguage(o.subtitleLang)
+	}
+	if o.audioLang != "" {
+		gen.SetAudioLanguage(o.audioLang)
+	}
+	if o.chapterSpacing > 0 {
+		gen.SetAutoChapters(o.chapterSpacing)
+	}
+	if o.previewFormat != "" {
+		return gen.SetPreviews(o.previewFormat)
+	}
+	return nil
+}
+
+// loadConfig reads the config file: --config, or vsite.json in the root
+// directory when it exists
+func loadConfig(rootDir, configPath string) (*generator.Config, error) {
+	required := configPath != ""
+	if !required {
+		configPath = filepath.Join(rootDir, generator.ConfigFileName)
+	}
+	return generator.LoadConfig(configPath, required)
+}
 
-	fmt.Println("Done! HTML files generated successfully.")
+// sameDirectory reports whether a and b refer to the same directory
+func sameDirectory(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return absA == absB
 }
 
 func validateDirectory(dir string) error {
@@ -147,6 +544,7 @@ func printUsage() {
 
 Usage:
   vsite [options] <directory>
+  vsite serve [options] [directory]
   vsite --clean <directory>
   vsite --clean-converted <directory>
   vsite --clean-original <directory>
@@ -162,12 +560,42 @@ Arguments:
 
 Options:
   -t, --title <text>   Sets the title of the main page (default: "Videos")
-  --convert            Converts incompatible videos (avi, mkv) to MP4
+  -o, --output <dir>   Writes the generated site to <dir> (default: <directory>)
+                       Video links are made relative to the output directory
+  --media-url <url>    Links videos using this base URL instead of relative paths
+  --convert            Converts incompatible videos (avi, mkv) to MP4, including
+                       files with codecs browsers can't play (HEVC, 10-bit, AC-3)
   --gpu                Uses NVIDIA GPU (NVENC) for faster conversion
                        Requires: NVIDIA driver and ffmpeg with NVENC support
+  -e, --encoder <name> Uses another encoder backend: libx264 (default),
+                       svt-av1, libvpx-vp9, nvenc, vaapi, qsv or videotoolbox
+  --format <name>      Converts to mp4 (H.264/AAC, default), av1 (AV1/AAC in
+                       MP4) or webm (VP9/Opus)
+  -j, --jobs <n>       Runs up to <n> conversions at the same time (default: 1)
+  --stall-timeout <d>  Stops a conversion that makes no progress for <d>
+                       (default: 5m, 0 to disable)
+  --profile <name>     Uses a conversion profile: default, archive, mobile,
+                       fast or one from the config file (default: default)
+  --config <file>      Reads profiles and HLS settings from <file>
+                       (default: vsite.json in the video directory, if present)
+  --hls                Also packages each video as HLS (adaptive streaming)
+                       with a 1080p/720p/480p ladder (configurable)
+  --subtitle-lang <l>  Enables subtitles in this language by default
+                       (e.g. en, pt-BR; default: subtitles off)
+  --audio-lang <l>     Prefers the audio track in this language in videos with
+                       several (e.g. en, pt-BR; default: the video's default)
+  --auto-chapters      Adds chapters at scene changes to videos without any
+  --chapter-spacing <d> Minimum time between detected chapters (default: 5m,
+                       implies --auto-chapters)
+  --previews           Plays a short silent preview when hovering over a video
+                       (or on long-press on touch screens)
+  --preview-format <f> Encodes previews as mp4 (default) or webm
+                       (implies --previews)
   -c, --clean          Removes all generated HTML files from the directory
-  --clean-converted    Removes converted MP4 files (keeps original avi, mkv, etc)
-  --clean-original     Removes original files that were converted (keeps MP4)
+  --clean-converted    Removes converted MP4/WebM files (keeps original avi, mkv, etc)
+  --clean-original     Removes original files that were converted (keeps MP4/WebM)
+  -w, --watch          Keeps running and regenerates the site when videos
+                       are added, removed, renamed or modified
   -h, --help           Shows this help
   -v, --version        Shows version
 
@@ -187,9 +615,70 @@ External dependencies:
 Examples:
   vsite /path/to/videos
   vsite --title "My Collection" /path/to/videos
+  vsite --output /var/www/videos /mnt/nas/videos
+  vsite --output ./site --media-url https://nas.local/videos /mnt/nas/videos
   vsite --convert /path/to/videos
+  vsite --watch /path/to/videos
+  vsite --hls /path/to/videos
+  vsite --subtitle-lang pt-BR /path/to/videos
+  vsite --convert --audio-lang ja /path/to/videos
+  vsite --auto-chapters --chapter-spacing 10m /path/to/videos
+  vsite --previews /path/to/videos
   vsite --convert --gpu /path/to/videos
+  vsite --convert --profile mobile /path/to/videos
+  vsite --convert --encoder vaapi /path/to/videos
+  vsite --convert --format webm /path/to/videos
+  vsite --convert --jobs 4 /path/to/videos
   vsite --clean /path/to/videos
   vsite --clean-converted /path/to/videos
-  vsite --clean-original /path/to/videos`)
+  vsite --clean-original /path/to/videos
+  vsite serve /path/to/videos
+
+Run 'vsite serve --help' for the HTTP server options.`)
+}
+
+func printServeUsage() {
+	fmt.Println(`vsite serve - HTTP server for the generated gallery
+
+Usage:
+  vsite serve [options] [directory]
+
+Description:
+  Serves the generated site and the videos with range request support,
+  so seeking works in the player. No external server is needed.
+
+Arguments:
+  [directory]          Root directory containing video files (default: current)
+
+Options:
+  -p, --port <port>    Port to listen on (default: 8000, or 8443 with --https)
+  -b, --bind <addr>    Address to listen on (default: all interfaces)
+  --https              Serves over HTTPS with a self-signed certificate
+                       (required by the Chromecast button)
+  --tls-dir <dir>      Where the CA and server certificates are kept
+                       (default: ~/.config/vsite/tls)
+  -o, --output <dir>   Directory with the generated site, when generated with --output
+                       Videos are then served under /media/ (generate with --media-url /media)
+  -w, --watch          Generates the site, regenerates it when the library changes
+                       and tells open browser tabs to reload
+  -h, --help           Shows this help
+
+Site options (with --watch, same as when generating with vsite):
+  -t, --title <text>   Sets the title of the main page
+  --config <file>      Reads HLS settings from <file>
+  --hls                Also packages each video as HLS (adaptive streaming)
+  --subtitle-lang <l>  Enables subtitles in this language by default
+  --audio-lang <l>     Prefers the audio track in this language
+  --auto-chapters      Adds chapters at scene changes to videos without any
+  --chapter-spacing <d> Minimum time between detected chapters
+  --previews           Plays a short silent preview when hovering over a video
+  --preview-format <f> Encodes previews as mp4 (default) or webm
+
+Examples:
+  vsite serve /path/to/videos
+  vsite serve --port 9000 /path/to/videos
+  vsite serve --https /path/to/videos
+  vsite serve --watch /path/to/videos
+  vsite serve --watch --hls --previews /path/to/videos
+  vsite serve --output ./site /mnt/nas/videos`)
 }
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"vsite/generator"
+)
+
+// URL of the event stream that tells open pages to reload
+const EventsPath = "/_vsite/events"
+
+// Interval between keep-alive comments on idle event streams
+const keepAliveInterval = 30 * time.Second
+
+// reloadHub broadcasts page changes to connected browsers
+type reloadHub struct {
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+}
+
+func newReloadHub() *reloadHub {
+	return &reloadHub{clients: make(map[chan []byte]struct{})}
+}
+
+// NotifyReload tells open browser tabs which pages were written or removed,
+// so they can reload (or leave a page that no longer exists)
+func (s *Server) NotifyReload(changes generator.PageChanges) {
+	if len(changes.Written) == 0 && len(changes.Removed) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return
+	}
+
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	for client := range s.hub.clients {
+		// Never block on a slow client; it will catch up on the next change
+		select {
+		case client <- data:
+		default:
+		}
+	}
+}
+
+// ServeHTTP streams reload events using Server-Sent Events
+func (h *reloadHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	client := make(chan []byte, 1)
+	h.mu.Lock()
+	h.clients[client] = struct{}{}
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.clients, client)
+		h.mu.Unlock()
+	}()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data := <-client:
+			fmt.Fprintf(w, "event: reload\ndata: %s\n\n", data)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"vsite/generator"
+)
+
+// URL prefix used for media when the site is generated in a separate directory
+const MediaPrefix = "/media/"
+
+// Server serves a generated site and its videos over HTTP
+type Server struct {
+	siteRoot  *os.Root // Generated pages
+	mediaRoot *os.Root // Videos (nil when they live in the site directory)
+	hub       *reloadHub
+}
+
+// New creates a server for the site in siteDir. If mediaDir differs from
+// siteDir, videos are served from mediaDir under MediaPrefix.
+func New(siteDir, mediaDir string) (*Server, error) {
+	siteRoot, err := os.OpenRoot(siteDir)
+	if err != nil {
+		return nil, fmt.Errorf("error opening site directory: %w", err)
+	}
+
+	s := &Server{siteRoot: siteRoot, hub: newReloadHub()}
+
+	if !sameDir(siteDir, mediaDir) {
+		s.mediaRoot, err = os.OpenRoot(mediaDir)
+		if err != nil {
+			siteRoot.Close()
+			return nil, fmt.Errorf("error opening media directory: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+// HasSeparateMedia reports whether videos are served under MediaPrefix
+func (s *Server) HasSeparateMedia() bool {
+	return s.mediaRoot != nil
+}
+
+// Handler returns the HTTP handler for the site and media
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", serveFiles(s.siteRoot))
+	mux.Handle(EventsPath, s.hub)
+	if s.mediaRoot != nil {
+		mux.Handle(MediaPrefix, http.StripPrefix(strings.TrimSuffix(MediaPrefix, "/"), serveFiles(s.mediaRoot)))
+	}
+	return logRequests(mux)
+}
+
+// ListenAndServe serves the site on addr until an error occurs
+func (s *Server) ListenAndServe(addr string) error {
+	defer s.Close()
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return srv.ListenAndServe()
+}
+
+// Close releases the served directories
+func (s *Server) Close() error {
+	if s.mediaRoot != nil {
+		s.mediaRoot.Close()
+	}
+	return s.siteRoot.Close()
+}
+
+// serveFiles serves files from root with Range support. Requests can't
+// escape root, neither through ".." nor through symlinks, and vsite's
+// internal files are not served.
+func serveFiles(root *os.Root) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if name == "" {
+			name = "."
+		}
+
+		// The configuration and vsite's state hold local paths
+		if generator.IsInternalFile(name) {
+			http.NotFound(w, r)
+			return
+		}
+
+		f, info, err := openFile(root, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				http.NotFound(w, r)
+			} else {
+				http.Error(w, "forbidden", http.StatusForbidden)
+			}
+			return
+		}
+		defer f.Close()
+
+		// Same MIME table as the player pages; other types are detected by ServeContent
+		if mimeType := generator.MimeType(filepath.Ext(info.Name())); mimeType != "" {
+			w.Header().Set("Content-Type", mimeType)
+		}
+
+		http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	})
+}
+
+// openFile opens name inside root. Directories resolve to their index.html
+// (there are no directory listings).
+func openFile(root *os.Root, name string) (*os.File, os.FileInfo, error) {
+	f, err := root.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	if info.IsDir() {
+		f.Close()
+		return openFile(root, path.Join(name, "index.html"))
+	}
+
+	return f, info, nil
+}
+
+// statusRecorder captures the response status for logging
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// ReadFrom keeps the underlying writer's sendfile optimization for video transfers
+func (r *statusRecorder) ReadFrom(src io.Reader) (int64, error) {
+	return io.Copy(r.ResponseWriter, src)
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// logRequests prints one line per request
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		fmt.Printf("%s %s %s %d\n", time.Now().Format("15:04:05"), r.Method, r.URL.Path, rec.status)
+	})
+}
+
+// LocalAddresses returns the non-loopback IPv4 addresses of this host
+func LocalAddresses() []net.IP {
+	var ips []net.IP
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ips
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() {
+			continue
+		}
+		if ip := ipNet.IP.To4(); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// sameDir reports whether a and b refer to the same directory
+func sameDir(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return absA == absB
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHandlerInternalFiles(t *testing.T) {
+	site, media := t.TempDir(), t.TempDir()
+	for _, dir := range []string{site, media} {
+		for _, name := range []string{
+			"index.html",
+			"movie.mp4",
+			"vsite.json",
+			filepath.Join(".vsite", "cache.json"),
+			filepath.Join(".vsite", "conversions.json"),
+			filepath.Join(".vsite", "thumbnails", "movie.jpg"),
+			filepath.Join(".vsite", "subtitles", "movie.en.vtt"),
+		} {
+			path := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	s, err := New(site, media)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	handler := s.Handler()
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/", http.StatusOK},
+		{"/movie.mp4", http.StatusOK},
+		{"/.vsite/thumbnails/movie.jpg", http.StatusOK},
+		{"/.vsite/subtitles/movie.en.vtt", http.StatusOK},
+		{"/vsite.json", http.StatusNotFound},
+		{"/VSITE.JSON", http.StatusNotFound},
+		{"/.vsite/cache.json", http.StatusNotFound},
+		{"/.vsite/conversions.json", http.StatusNotFound},
+		{"/media/movie.mp4", http.StatusOK},
+		{"/media/.vsite/thumbnails/movie.jpg", http.StatusOK},
+		{"/media/vsite.json", http.StatusNotFound},
+		{"/media/.vsite/cache.json", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.status {
+			t.Errorf("GET %s = %d, want %d", tt.path, rec.Code, tt.status)
+		}
+	}
+}
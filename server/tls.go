@@ -0,0 +1,361 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// URL where the CA certificate can be downloaded (e.g. from phones and tablets)
+const CAPath = "/vsite-ca.crt"
+
+// Certificate validity. Browsers reject server certificates valid for more
+// than 825 days, so the server certificate is renewed well before that.
+const (
+	caValidity     = 10 * 365 * 24 * time.Hour
+	serverValidity = 800 * 24 * time.Hour
+	renewBefore    = 30 * 24 * time.Hour
+)
+
+// Networks the CA may issue certificates for: loopback, private (RFC 1918),
+// unique local (ULA) and link-local addresses. Together with the names in
+// caDNSDomains, they limit what a leaked CA key could be used for.
+var caIPRanges = []string{
+	"127.0.0.0/8",
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"169.254.0.0/16",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+}
+
+// caDNSDomains returns the names the CA may issue certificates for:
+// localhost, mDNS names (.local) and the hostname
+func caDNSDomains() []string {
+	domains := []string{"localhost", ".local"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" && !strings.HasSuffix(hostname, ".local") {
+		domains = append(domains, hostname)
+	}
+	return domains
+}
+
+// Certificates holds the paths of the generated TLS files
+type Certificates struct {
+	CACert     string // CA certificate (the one users trust)
+	CAKey      string // CA private key
+	ServerCert string // Server certificate signed by the CA
+	ServerKey  string // Server private key
+}
+
+// DefaultCertDir returns the directory where certificates are persisted
+func DefaultCertDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "vsite", "tls"), nil
+}
+
+// LocalHosts returns the names and addresses the server certificate covers:
+// localhost, the hostname and the LAN IPs of this host
+func LocalHosts() []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		hosts = append(hosts, hostname)
+		if !strings.Contains(hostname, ".") {
+			hosts = append(hosts, hostname+".local")
+		}
+	}
+	for _, ip := range LocalAddresses() {
+		hosts = append(hosts, ip.String())
+	}
+	return hosts
+}
+
+// EnsureCertificates loads or creates a self-signed CA and a server
+// certificate in dir. The CA is created once and reused, so it only has to
+// be trusted once; the server certificate is recreated when it expires or
+// when hosts are not covered (e.g. the LAN IP changed).
+func EnsureCertificates(dir string, hosts []string) (*Certificates, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	certs := &Certificates{
+		CACert:     filepath.Join(dir, "ca.pem"),
+		CAKey:      filepath.Join(dir, "ca-key.pem"),
+		ServerCert: filepath.Join(dir, "server.pem"),
+		ServerKey:  filepath.Join(dir, "server-key.pem"),
+	}
+
+	ca, caKey, err := loadKeyPair(certs.CACert, certs.CAKey)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("error loading CA certificate: %w", err)
+		}
+		fmt.Println("Creating local certificate authority...")
+		ca, caKey, err = createCA(certs.CACert, certs.CAKey)
+		if err != nil {
+			return nil, fmt.Errorf("error creating CA certificate: %w", err)
+		}
+	} else if !ca.PermittedDNSDomainsCritical {
+		fmt.Printf("Warning: The local CA was created without name constraints. Delete %s to create a new one (and trust it again).\n", dir)
+	}
+
+	// Certificates covering other names or addresses would be rejected
+	hosts = permittedHosts(ca, hosts)
+
+	cert, _, err := loadKeyPair(certs.ServerCert, certs.ServerKey)
+	if err == nil && serverCertValid(cert, ca, hosts) {
+		return certs, nil
+	}
+
+	fmt.Println("Creating server certificate...")
+	if err := createServerCert(certs.ServerCert, certs.ServerKey, ca, caKey, hosts); err != nil {
+		return nil, fmt.Errorf("error creating server certificate: %w", err)
+	}
+	return certs, nil
+}
+
+// serverCertValid reports whether cert is signed by ca, is not about to
+// expire and covers all hosts
+func serverCertValid(cert, ca *x509.Certificate, hosts []string) bool {
+	if time.Now().Add(renewBefore).After(cert.NotAfter) {
+		return false
+	}
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		return false
+	}
+	for _, host := range hosts {
+		if err := cert.VerifyHostname(host); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// createCA generates the CA key pair and writes it to disk
+func createCA(certPath, keyPath string) (*x509.Certificate, crypto.Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"vsite"},
+			CommonName:   strings.TrimSpace("vsite local CA " + hostname),
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+
+		// Only valid for local names and addresses
+		PermittedDNSDomainsCritical: true,
+		PermittedDNSDomains:         caDNSDomains(),
+	}
+	for _, cidr := range caIPRanges {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, nil, err
+		}
+		template.PermittedIPRanges = append(template.PermittedIPRanges, ipNet)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writeKeyPair(certPath, keyPath, der, key); err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	return cert, key, err
+}
+
+// permittedHosts returns the hosts allowed by the name constraints of ca
+func permittedHosts(ca *x509.Certificate, hosts []string) []string {
+	var permitted []string
+	for _, host := range hosts {
+		if hostPermitted(ca, host) {
+			permitted = append(permitted, host)
+		}
+	}
+	return permitted
+}
+
+// hostPermitted reports whether the name constraints of ca allow host.
+// A CA without constraints allows every host.
+func hostPermitted(ca *x509.Certificate, host string) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		if len(ca.PermittedIPRanges) == 0 {
+			return true
+		}
+		for _, ipNet := range ca.PermittedIPRanges {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(ca.PermittedDNSDomains) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, domain := range ca.PermittedDNSDomains {
+		domain = strings.ToLower(domain)
+		if strings.HasPrefix(domain, ".") {
+			// Subdomains only
+			if strings.HasSuffix(host, domain) {
+				return true
+			}
+		} else if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// createServerCert generates a server key pair for hosts, signed by the CA
+func createServerCert(certPath, keyPath string, ca *x509.Certificate, caKey crypto.Signer, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"vsite"},
+			CommonName:   hosts[0],
+		},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(serverValidity),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), caKey)
+	if err != nil {
+		return err
+	}
+	return writeKeyPair(certPath, keyPath, der, key)
+}
+
+// loadKeyPair reads a PEM certificate and private key
+func loadKeyPair(certPath, keyPath string) (*x509.Certificate, crypto.Signer, error) {
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signer, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported private key in %s", keyPath)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, signer, nil
+}
+
+// writeKeyPair writes a DER certificate and its private key as PEM files
+func writeKeyPair(certPath, keyPath string, der []byte, key crypto.Signer) error {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return os.WriteFile(certPath, certPEM, 0644)
+}
+
+// randomSerial returns a random 128-bit certificate serial number
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// ListenAndServeTLS serves the site over HTTPS on addr until an error occurs.
+// The CA certificate is also served at CAPath so other devices can trust it.
+func (s *Server) ListenAndServeTLS(addr string, certs *Certificates) error {
+	defer s.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(CAPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+		http.ServeFile(w, r, certs.CACert)
+	})
+	mux.Handle("/", s.Handler())
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return srv.ListenAndServeTLS(certs.ServerCert, certs.ServerKey)
+}
+
+// TrustInstructions explains how to trust the CA certificate on common platforms
+func TrustInstructions(caCert, caURL string) string {
+	return fmt.Sprintf(`To avoid certificate warnings (and enable the Cast button), trust the
+local CA certificate once on each device:
+  %[1]s
+
+  Debian/Ubuntu:  sudo cp "%[1]s" /usr/local/share/ca-certificates/vsite-ca.crt
+                  sudo update-ca-certificates
+  Fedora/RHEL:    sudo cp "%[1]s" /etc/pki/ca-trust/source/anchors/vsite-ca.pem
+                  sudo update-ca-trust
+  macOS:          sudo security add-trusted-cert -d -r trustRoot \
+                    -k /Library/Keychains/System.keychain "%[1]s"
+  Windows:        certutil -addstore -f ROOT "%[1]s"
+  Firefox:        Settings > Privacy & Security > Certificates > Import
+  Android/iOS:    download %[2]s and install it as a CA certificate
+
+Chrome and Edge use the system store (restart the browser after trusting).`, caCert, caURL)
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"crypto/x509"
+	"slices"
+	"testing"
+)
+
+func TestEnsureCertificatesNameConstraints(t *testing.T) {
+	hosts := []string{"localhost", "127.0.0.1", "::1", "box.local", "192.168.1.10", "fd12::1", "8.8.8.8", "example.com"}
+	certs, err := EnsureCertificates(t.TempDir(), hosts)
+	if err != nil {
+		t.Fatalf("EnsureCertificates() = %v", err)
+	}
+
+	ca, _, err := loadKeyPair(certs.CACert, certs.CAKey)
+	if err != nil {
+		t.Fatalf("loading CA: %v", err)
+	}
+	if !ca.PermittedDNSDomainsCritical {
+		t.Error("CA name constraints are not critical")
+	}
+	if !slices.Contains(ca.PermittedDNSDomains, "localhost") || !slices.Contains(ca.PermittedDNSDomains, ".local") {
+		t.Errorf("PermittedDNSDomains = %q, want localhost and .local", ca.PermittedDNSDomains)
+	}
+	if len(ca.PermittedIPRanges) != len(caIPRanges) {
+		t.Errorf("PermittedIPRanges = %v, want %q", ca.PermittedIPRanges, caIPRanges)
+	}
+
+	cert, _, err := loadKeyPair(certs.ServerCert, certs.ServerKey)
+	if err != nil {
+		t.Fatalf("loading server certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	for _, host := range []string{"localhost", "127.0.0.1", "::1", "box.local", "192.168.1.10", "fd12::1"} {
+		if _, err := cert.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+			t.Errorf("Verify(%s) = %v", host, err)
+		}
+	}
+	for _, host := range []string{"8.8.8.8", "example.com"} {
+		if err := cert.VerifyHostname(host); err == nil {
+			t.Errorf("server certificate covers %s, outside the CA name constraints", host)
+		}
+	}
+}
+
+func TestHostPermitted(t *testing.T) {
+	constrained := &x509.Certificate{PermittedDNSDomains: []string{"localhost", ".local", "box"}}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"localhost", true},
+		{"LOCALHOST", true},
+		{"box", true},
+		{"media.box", true},
+		{"box.local", true},
+		{"local", false},
+		{"example.com", false},
+		{"notbox", false},
+	}
+
+	for _, tt := range tests {
+		if got := hostPermitted(constrained, tt.host); got != tt.want {
+			t.Errorf("hostPermitted(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+	if !hostPermitted(&x509.Certificate{}, "example.com") {
+		t.Error("a CA without name constraints should permit every host")
+	}
+}